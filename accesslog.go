@@ -0,0 +1,86 @@
+package grest
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// AccessEntry is JSON access log entry of a request
+type AccessEntry struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Path      string    `json:"path"`
+	Resource  string    `json:"resource,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Status    int       `json:"status"`
+	Duration  float64   `json:"durationMs"`
+	Bytes     int       `json:"bytes"`
+	RemoteIP  string    `json:"remoteIp"`
+	Principal string    `json:"principal,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Filter    *Filter   `json:"filter,omitempty"`
+}
+
+// AccessLog write JSON access logs of requests, one entry per line
+//
+//	api.Container.Filter(grest.NewAccessLog(os.Stdout).Filter)
+type AccessLog struct {
+	Writer io.Writer
+	mu     sync.Mutex
+}
+
+// NewAccessLog is create AccessLog writing into w, default is stdout
+func NewAccessLog(w io.Writer) *AccessLog {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &AccessLog{Writer: w}
+}
+
+// Filter is restful filter logging requests, use it as container filter so the principal of resource Middleware is logged
+func (l *AccessLog) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+	chain.ProcessFilter(request, response)
+	route := selectedRoute(request)
+	if route == nil {
+		// dispatch error, its status is not known by the response
+		return
+	}
+	entry := &AccessEntry{
+		Time:     start,
+		Method:   request.Request.Method,
+		Path:     request.Request.URL.Path,
+		Status:   response.StatusCode(),
+		Duration: float64(time.Since(start)) / float64(time.Millisecond),
+		Bytes:    response.ContentLength(),
+		RemoteIP: clientIP(request.Request),
+	}
+	entry.Resource, entry.Action = routeLabels(route)
+	if principal := PrincipalFromRequest(request.Request); principal != nil {
+		entry.Principal = principal.ID
+		entry.Tenant = principal.Tenant
+	}
+	if raw := request.QueryParameter("filter"); raw != "" {
+		if filter, err := ParseFilter(raw); err == nil {
+			entry.Filter = normalizeFilter(filter)
+		}
+	}
+	l.Write(entry)
+}
+
+// Write write the entry as a JSON line
+func (l *AccessLog) Write(entry *AccessEntry) error {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.Writer.Write(append(b, '\n'))
+	return err
+}
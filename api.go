@@ -0,0 +1,152 @@
+package grest
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+// ResourceConfig is resource configuration
+type ResourceConfig struct {
+	// Path is url path of the resource, default is ToParamString of the model name
+	Path string
+	// ReadOnly only register GET routes
+	ReadOnly bool
+	// Methods are registered http methods, default is all
+	Methods []string
+	// Middleware are filters of the resource web service
+	Middleware []restful.FilterFunction
+	// Consumes and Produces are MIME types of the resource, default is JSON
+	Consumes []string
+	Produces []string
+	// View is data access of the resource, default is APIView
+	View View
+	// Hooks prepare the request context of the resource, they run after hooks of API
+	Hooks []ContextHook
+	// Policy authorize actions on the resource, default is Policy of API
+	Policy Policy
+	// Scopes are scopes of principal required by actions, see Auth
+	Scopes map[Action][]string
+	// History keep versions of the resource, its table must be migrated, see History.Migrate
+	History *History
+	// Stream serve GET /{resource}/stream of changes, see Stream
+	Stream *Stream
+}
+
+// Resource is model registered in API
+type Resource struct {
+	Name   string
+	Path   string
+	Value  interface{}
+	Config ResourceConfig
+	View   *GenericAPIView
+}
+
+// API is resource registry, it mounts models into a restful container
+type API struct {
+	Container *restful.Container
+	Context   *Context
+	// Hooks prepare the request context of resources added afterwards, e.g. Tenancy.Hook
+	Hooks []ContextHook
+	// Policy authorize actions on resources without their own policy
+	Policy    Policy
+	resources []*Resource
+}
+
+// NewAPI is create API, if container is nil restful.DefaultContainer is used
+func NewAPI(container *restful.Container, cxt *Context) *API {
+	if container == nil {
+		container = restful.DefaultContainer
+	}
+	return &API{Container: container, Context: cxt}
+}
+
+// AddResource register model into API and its container, it fails if the path is registered in the container
+//
+//	api.AddResource(&User{}, grest.ResourceConfig{ReadOnly: true})
+func (api *API) AddResource(value interface{}, configs ...ResourceConfig) (*Resource, error) {
+	view := new(GenericAPIView)
+	if len(configs) > 0 {
+		view.View = configs[0].View
+	}
+	view.Init(api.Context, value)
+	return api.mount(view, configs...)
+}
+
+// mount register the initialized view into API and its container
+func (api *API) mount(view *GenericAPIView, configs ...ResourceConfig) (*Resource, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+
+	name := ModelType(view.Value).Name()
+	urlPath := strings.Trim(config.Path, "/")
+	if urlPath == "" {
+		urlPath = ToParamString(name)
+	}
+
+	view.Consumes = config.Consumes
+	view.Produces = config.Produces
+	view.Methods = config.Methods
+	view.Hooks = append(append(view.Hooks, api.Hooks...), config.Hooks...)
+	view.Policy = config.Policy
+	if view.Policy == nil {
+		view.Policy = api.Policy
+	}
+	view.Scopes = config.Scopes
+	view.History = config.History
+	view.Stream = config.Stream
+	if config.ReadOnly {
+		view.Methods = []string{http.MethodGet}
+	}
+	for _, filter := range config.Middleware {
+		view.WS.Filter(filter)
+	}
+	view.WebService(urlPath)
+	if err := api.add(view.WS); err != nil {
+		return nil, err
+	}
+
+	res := &Resource{Name: name, Path: urlPath, Value: view.Value, Config: config, View: view}
+	api.resources = append(api.resources, res)
+	return res, nil
+}
+
+// add register the web service into the container, restful exits the process on a duplicate root path,
+// so it is checked first
+func (api *API) add(ws *restful.WebService) error {
+	if err := api.checkPath(ws.RootPath()); err != nil {
+		return err
+	}
+	api.Container.Add(ws)
+	return nil
+}
+
+// checkPath return error if a web service of the path is registered in the container
+func (api *API) checkPath(path string) error {
+	path = "/" + strings.Trim(path, "/")
+	for _, each := range api.Container.RegisteredWebServices() {
+		if "/"+strings.Trim(each.RootPath(), "/") == path {
+			return fmt.Errorf("path %s is registered in the container", path)
+		}
+	}
+	return nil
+}
+
+// Resources return registered resources
+func (api *API) Resources() []*Resource {
+	return api.resources
+}
+
+// GetResource get registered resource by name or path
+func (api *API) GetResource(name string) *Resource {
+	for _, res := range api.resources {
+		if res.Name == name || res.Path == name {
+			return res
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestAPI_AddResource(t *testing.T) {
+	h := gresttest.New(t, &Doc{})
+	defer h.Close()
+
+	if _, err := h.API.AddResource(&Doc{}); err == nil {
+		t.Fatal("expected error of duplicate path")
+	}
+	if _, err := h.API.AddResource(&Note{}, grest.ResourceConfig{Path: "/doc/"}); err == nil {
+		t.Fatal("expected error of duplicate path")
+	}
+	res, err := h.API.AddResource(&Doc{}, grest.ResourceConfig{Path: "docs", ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h.API.Resources()) != 2 || h.API.GetResource("docs") != res {
+		t.Fatalf("unexpected resources %+v", h.API.Resources())
+	}
+	h.POST("/doc").JSON(&Doc{Title: "t"}).Expect().Status(http.StatusOK)
+	h.GET("/docs").Expect().Status(http.StatusOK).Count(1)
+
+	if _, err := grest.AddTypedResource[Doc](h.API); err == nil {
+		t.Fatal("expected error of duplicate typed resource")
+	}
+	if _, err := h.API.AddLiveService(grest.ResourceConfig{Path: "doc"}); err == nil {
+		t.Fatal("expected error of duplicate live service")
+	}
+	metrics := grest.NewMetrics(nil)
+	if err := h.API.AddMetricsService(metrics, "/docs"); err == nil {
+		t.Fatal("expected error of duplicate metrics path")
+	}
+	if err := h.API.AddMetricsService(metrics); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.API.AddMetricsService(metrics); err == nil {
+		t.Fatal("expected error of duplicate metrics handler")
+	}
+}
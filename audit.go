@@ -0,0 +1,143 @@
+package grest
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// AuditTable is table name of AuditLog
+var AuditTable = "audit_log"
+
+// AuditLog is record of a write
+type AuditLog struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	Actor      string    `json:"actor" gorm:"index"`
+	TenantID   string    `json:"tenantId" gorm:"index"`
+	Resource   string    `json:"resource" gorm:"index"`
+	ResourceID string    `json:"resourceId" gorm:"index"`
+	Action     string    `json:"action"`
+	Diff       string    `json:"diff" gorm:"type:text"`
+	CreatedAt  time.Time `json:"createdAt" gorm:"index"`
+}
+
+// TableName is AuditTable
+func (AuditLog) TableName() string {
+	return AuditTable
+}
+
+// FieldChange is before and after value of a changed field
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Audit record writes of APIView into AuditLog in the same transaction
+//
+//	audit := grest.NewAudit("password")
+//	audit.Migrate(db)
+//	api.Context.WriteHooks = append(api.Context.WriteHooks, audit.Hook())
+//	api.AddAuditResource()
+type Audit struct {
+	// Ignore are json fields not recorded, e.g. password
+	Ignore []string
+	// Actor of the change, default is id of Principal
+	Actor func(cxt *Context) string
+}
+
+// NewAudit is create Audit, ignore are json fields not recorded
+func NewAudit(ignore ...string) *Audit {
+	return &Audit{Ignore: ignore}
+}
+
+// Migrate create the audit table
+func (a *Audit) Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&AuditLog{}).Error
+}
+
+// Hook is WriteHook inserting AuditLog of the change
+func (a *Audit) Hook() WriteHook {
+	return func(tx *gorm.DB, change *Change) error {
+		diff, err := AuditDiff(change.Before, change.After, a.Ignore...)
+		if err != nil {
+			return err
+		}
+		if change.Action == ActionUpdate && len(diff) == 0 {
+			return nil
+		}
+		b, err := json.Marshal(diff)
+		if err != nil {
+			return err
+		}
+		log := &AuditLog{
+			Resource:   change.Resource,
+			ResourceID: change.ID,
+			Action:     string(change.Action),
+			Diff:       string(b),
+		}
+		if cxt := change.Context; cxt != nil {
+			log.TenantID = cxt.TenantID
+			if a.Actor != nil {
+				log.Actor = a.Actor(cxt)
+			} else if cxt.Principal != nil {
+				log.Actor = cxt.Principal.ID
+			}
+		}
+		return tx.Create(log).Error
+	}
+}
+
+// AuditDiff compare json fields of before and after, nil is empty data
+func AuditDiff(before, after interface{}, ignore ...string) (map[string]FieldChange, error) {
+	from, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+	diff := map[string]FieldChange{}
+	for name, value := range to {
+		if old, ok := from[name]; !ok || !reflect.DeepEqual(old, value) {
+			diff[name] = FieldChange{Before: from[name], After: value}
+		}
+	}
+	for name, value := range from {
+		if _, ok := to[name]; !ok {
+			diff[name] = FieldChange{Before: value}
+		}
+	}
+	for _, name := range ignore {
+		delete(diff, name)
+	}
+	return diff, nil
+}
+
+// jsonFields get json fields of the value
+func jsonFields(value interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if value == nil {
+		return fields, nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return fields, json.Unmarshal(b, &fields)
+}
+
+// AddAuditResource register read-only resource of AuditLog, default path is audit
+func (api *API) AddAuditResource(configs ...ResourceConfig) (*Resource, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Path == "" {
+		config.Path = "audit"
+	}
+	config.ReadOnly = true
+	return api.AddResource(&AuditLog{}, config)
+}
@@ -0,0 +1,60 @@
+package grest_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestAudit(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	audit := grest.NewAudit("secret")
+	if err := audit.Migrate(h.DB); err != nil {
+		t.Fatal(err)
+	}
+	h.API.Context.WriteHooks = []grest.WriteHook{audit.Hook()}
+	principal := func(cxt *grest.Context) error {
+		cxt.Principal = &grest.Principal{ID: cxt.Request.HeaderParameter("X-User")}
+		return nil
+	}
+	h.AddResource(&Doc{}, grest.ResourceConfig{Hooks: []grest.ContextHook{principal}})
+	if _, err := h.API.AddAuditResource(); err != nil {
+		t.Fatal(err)
+	}
+
+	doc := new(Doc)
+	h.POST("/doc").Header("X-User", "u1").JSON(&Doc{Title: "a", Secret: "s"}).Expect().Status(http.StatusOK).JSON(doc)
+	doc.Title = "b"
+	h.PUT("/doc").Header("X-User", "u2").JSON(doc).Expect().Status(http.StatusOK)
+	h.DELETE("/doc").Header("X-User", "u3").JSON(doc).Expect().Status(http.StatusOK)
+	h.POST("/audit").JSON(&grest.AuditLog{}).Expect().Status(http.StatusMethodNotAllowed)
+
+	var logs []grest.AuditLog
+	filter := &grest.Filter{Where: []interface{}{"resource = ? AND resource_id = ?", "Doc", "1"}, Order: "id"}
+	h.GET("/audit").Filter(filter).Expect().Status(http.StatusOK).Count(3).JSON(&logs)
+	if logs[1].Actor != "u2" || logs[1].Action != "update" || logs[1].Diff != `{"title":{"before":"a","after":"b"}}` {
+		t.Fatalf("unexpected update log %+v", logs[1])
+	}
+	if strings.Contains(logs[0].Diff, "secret") || logs[2].Action != "delete" {
+		t.Fatalf("unexpected logs %+v", logs)
+	}
+
+	cxt := h.Context()
+	cxt.WriteHooks = append(cxt.WriteHooks, func(tx *gorm.DB, change *grest.Change) error {
+		return errors.New("rejected")
+	})
+	if err := new(grest.APIView).Save(&Doc{Title: "c"}, cxt); err == nil {
+		t.Fatal("expected hook error")
+	}
+	count := 0
+	h.DB.Model(&Doc{}).Where("title = ?", "c").Count(&count)
+	if count != 0 {
+		t.Fatal("write is not rolled back")
+	}
+}
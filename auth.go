@@ -0,0 +1,386 @@
+package grest
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// ContextPrincipalName principal name used for request context
+var ContextPrincipalName ContextKey = "ContextPrincipal"
+
+// KeyScopes is route metadata of required scopes
+const KeyScopes = "grest.scopes"
+
+// APIKeyHeader is default header of API key
+const APIKeyHeader = "X-API-Key"
+
+var (
+	errInvalidToken  = errors.New("invalid token")
+	errTokenExpired  = errors.New("token is expired")
+	errMissingExp    = errors.New("token has no exp")
+	errInvalidAPIKey = errors.New("invalid api key")
+	errMissingScope  = errors.New("insufficient scope")
+)
+
+// Authenticator authenticate the request
+// it returns nil principal without error if the request has no credential of it
+type Authenticator interface {
+	Authenticate(request *http.Request) (*Principal, error)
+}
+
+// Auth authenticate requests with the authenticators in order, the first principal is used
+//
+//	auth := grest.NewAuth(true, &grest.JWTAuth{Secret: secret}, &grest.APIKeyAuth{Store: keys})
+//	api.AddResource(&User{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{auth.Filter}})
+type Auth struct {
+	Authenticators []Authenticator
+	// Required reject anonymous requests
+	Required bool
+}
+
+// NewAuth is create Auth
+func NewAuth(required bool, authenticators ...Authenticator) *Auth {
+	return &Auth{Authenticators: authenticators, Required: required}
+}
+
+// Authenticate get principal of the request, nil is anonymous
+func (a *Auth) Authenticate(request *http.Request) (*Principal, error) {
+	for _, authenticator := range a.Authenticators {
+		principal, err := authenticator.Authenticate(request)
+		if err != nil {
+			return nil, err
+		}
+		if principal != nil {
+			return principal, nil
+		}
+	}
+	if a.Required {
+		return nil, errUnauthorize
+	}
+	return nil, nil
+}
+
+// Filter is restful filter putting the principal into request context, 401 is responded on failure
+func (a *Auth) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	principal, err := a.Authenticate(request.Request)
+	if err != nil {
+		response.AddHeader("WWW-Authenticate", "Bearer")
+		response.WriteHeaderAndEntity(http.StatusUnauthorized, NewErrorMsg(http.StatusUnauthorized, "authenticate", err.Error()))
+		return
+	}
+	if principal != nil {
+		request.Request = WithPrincipal(request.Request, principal)
+	}
+	chain.ProcessFilter(request, response)
+}
+
+// Middleware is net/http middleware of Auth, e.g. for GenericAPIView.HTTPHandler
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeHTTPResult(w, restful.MIME_JSON, errorResult(http.StatusUnauthorized, "authenticate", err))
+			return
+		}
+		if principal != nil {
+			r = WithPrincipal(r, principal)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// WithPrincipal put the principal into request context
+func WithPrincipal(request *http.Request, principal *Principal) *http.Request {
+	return request.WithContext(context.WithValue(request.Context(), ContextPrincipalName, principal))
+}
+
+// PrincipalFromRequest get principal from request context
+func PrincipalFromRequest(request *http.Request) *Principal {
+	principal, _ := request.Context().Value(ContextPrincipalName).(*Principal)
+	return principal
+}
+
+// PrincipalTenant resolve tenant id from the authenticated principal
+func PrincipalTenant() TenantResolver {
+	return func(request *http.Request) string {
+		if principal := PrincipalFromRequest(request); principal != nil {
+			return principal.Tenant
+		}
+		return ""
+	}
+}
+
+// bearerToken get bearer token of Authorization header
+func bearerToken(request *http.Request) string {
+	auth := request.Header.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// JWTAuth verify HS256 and RS256 bearer tokens
+type JWTAuth struct {
+	// Secret verify HS256 tokens
+	Secret []byte
+	// Keys verify RS256 tokens by key id, see LoadJWKS
+	Keys map[string]*rsa.PublicKey
+	// Issuer and Audience are checked if not empty
+	Issuer   string
+	Audience string
+	// Leeway is allowed clock skew of exp and nbf
+	Leeway time.Duration
+	// RequireExp reject tokens without exp, nil is true
+	RequireExp *bool
+	// RolesClaim, TenantClaim and ScopeClaim are claims of Principal, default roles, tenant and scope
+	RolesClaim  string
+	TenantClaim string
+	ScopeClaim  string
+}
+
+// Authenticate verify the bearer token
+func (j *JWTAuth) Authenticate(request *http.Request) (*Principal, error) {
+	token := bearerToken(request)
+	if token == "" {
+		return nil, nil
+	}
+	claims, err := j.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return j.principal(claims), nil
+}
+
+// Verify verify signature and time of the token, the claims are returned
+func (j *JWTAuth) Verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "HS256":
+		if len(j.Secret) == 0 {
+			return nil, errInvalidToken
+		}
+		mac := hmac.New(sha256.New, j.Secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errInvalidToken
+		}
+	case "RS256":
+		key := j.Keys[header.Kid]
+		if key == nil && header.Kid == "" && len(j.Keys) == 1 {
+			for _, k := range j.Keys {
+				key = k
+			}
+		}
+		if key == nil {
+			return nil, errInvalidToken
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errInvalidToken
+		}
+	default:
+		return nil, fmt.Errorf("unsupported token algorithm %q", header.Alg)
+	}
+
+	claims := map[string]interface{}{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	now := time.Now()
+	exp, ok := claimTime(claims["exp"])
+	if !ok && (j.RequireExp == nil || *j.RequireExp) {
+		return nil, errMissingExp
+	}
+	if ok && now.After(exp.Add(j.Leeway)) {
+		return nil, errTokenExpired
+	}
+	if nbf, ok := claimTime(claims["nbf"]); ok && now.Add(j.Leeway).Before(nbf) {
+		return nil, errInvalidToken
+	}
+	if j.Issuer != "" && claims["iss"] != j.Issuer {
+		return nil, errInvalidToken
+	}
+	if j.Audience != "" && !containsString(claimStrings(claims["aud"]), j.Audience) {
+		return nil, errInvalidToken
+	}
+	return claims, nil
+}
+
+// principal map claims into Principal
+func (j *JWTAuth) principal(claims map[string]interface{}) *Principal {
+	principal := &Principal{
+		Roles:  claimStrings(claims[stringOr(j.RolesClaim, "roles")]),
+		Scopes: claimStrings(claims[stringOr(j.ScopeClaim, "scope")]),
+	}
+	if sub, ok := claims["sub"]; ok && sub != nil {
+		principal.ID = fmt.Sprint(sub)
+	}
+	if tenant, ok := claims[stringOr(j.TenantClaim, "tenant")]; ok && tenant != nil {
+		principal.Tenant = fmt.Sprint(tenant)
+	}
+	return principal
+}
+
+// decodeSegment decode base64url JSON segment of token
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// claimTime get time of numeric date claim
+func claimTime(v interface{}) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// claimStrings get strings of array or space separated claim
+func claimStrings(v interface{}) []string {
+	switch value := v.(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, item := range value {
+			values = append(values, fmt.Sprint(item))
+		}
+		return values
+	}
+	return nil
+}
+
+// stringOr return s, or def if s is empty
+func stringOr(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// containsString is whether the slice contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadJWKS load RSA public keys of local JWKS file by key id
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(b)
+}
+
+// ParseJWKS parse RSA public keys of JWKS by key id
+func ParseJWKS(b []byte) (map[string]*rsa.PublicKey, error) {
+	jwks := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(b, &jwks); err != nil {
+		return nil, err
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, key := range jwks.Keys {
+		if key.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %v", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+// APIKeyStore look up principal of API key, nil principal is unknown key
+type APIKeyStore interface {
+	Lookup(key string) (*Principal, error)
+}
+
+// APIKeys is static APIKeyStore
+type APIKeys map[string]*Principal
+
+// Lookup get principal of the key
+func (keys APIKeys) Lookup(key string) (*Principal, error) {
+	return keys[key], nil
+}
+
+// APIKeyAuth authenticate API key of the header
+type APIKeyAuth struct {
+	// Header of the key, default is APIKeyHeader
+	Header string
+	Store  APIKeyStore
+}
+
+// Authenticate look up the key in the store
+func (a *APIKeyAuth) Authenticate(request *http.Request) (*Principal, error) {
+	key := request.Header.Get(stringOr(a.Header, APIKeyHeader))
+	if key == "" {
+		return nil, nil
+	}
+	principal, err := a.Store.Lookup(key)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, errInvalidAPIKey
+	}
+	return principal, nil
+}
@@ -0,0 +1,139 @@
+package grest_test
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TToken(t *testing.T, alg, kid string, claims map[string]interface{}, sign func([]byte) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestAuth(t *testing.T) {
+	secret := []byte("secret")
+	hs256 := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	auth := grest.NewAuth(true, &grest.JWTAuth{Secret: secret}, &grest.APIKeyAuth{Store: grest.APIKeys{
+		"k1": {ID: "service", Scopes: []string{"doc:read"}},
+	}})
+
+	h := gresttest.New(t)
+	defer h.Close()
+	h.AddResource(&Doc{}, grest.ResourceConfig{
+		Middleware: []restful.FilterFunction{auth.Filter},
+		Scopes:     map[grest.Action][]string{grest.ActionList: {"doc:read"}, grest.ActionCreate: {"doc:write"}},
+	})
+
+	exp := time.Now().Add(time.Hour).Unix()
+	writer := TToken(t, "HS256", "", map[string]interface{}{"sub": "u1", "scope": "doc:read doc:write", "exp": exp}, hs256)
+	expired := TToken(t, "HS256", "", map[string]interface{}{"sub": "u1", "exp": 1}, hs256)
+	forged := TToken(t, "HS256", "", map[string]interface{}{"sub": "u1", "exp": exp}, func(b []byte) []byte { return b })
+	noExp := TToken(t, "HS256", "", map[string]interface{}{"sub": "u1", "scope": "doc:read"}, hs256)
+
+	h.GET("/doc").Expect().Status(http.StatusUnauthorized).Error(http.StatusUnauthorized)
+	h.GET("/doc").Header("Authorization", "Bearer "+expired).Expect().Status(http.StatusUnauthorized)
+	h.GET("/doc").Header("Authorization", "Bearer "+forged).Expect().Status(http.StatusUnauthorized)
+	h.GET("/doc").Header("Authorization", "Bearer "+noExp).Expect().Status(http.StatusUnauthorized)
+	h.GET("/doc").Header(grest.APIKeyHeader, "bad").Expect().Status(http.StatusUnauthorized)
+	h.GET("/doc").Header(grest.APIKeyHeader, "k1").Expect().Status(http.StatusOK)
+	h.POST("/doc").Header(grest.APIKeyHeader, "k1").JSON(&Doc{Title: "t"}).Expect().Status(http.StatusForbidden)
+	h.POST("/doc").Header("Authorization", "Bearer "+writer).JSON(&Doc{Title: "t"}).Expect().Status(http.StatusOK)
+
+	s := grest.OpenAPIService(h.Container, restfulspec.Config{})
+	h.Container.Add(s)
+	recorder := httptest.NewRecorder()
+	h.Container.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, grest.OpenAPIPath, nil))
+	swagger := struct {
+		SecurityDefinitions map[string]struct {
+			Type string `json:"type"`
+			Name string `json:"name"`
+		} `json:"securityDefinitions"`
+		Paths map[string]map[string]struct {
+			Scopes []string `json:"x-scopes"`
+		} `json:"paths"`
+	}{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &swagger); err != nil {
+		t.Fatal(err)
+	}
+	bearer, apiKey := swagger.SecurityDefinitions[grest.SecurityBearer], swagger.SecurityDefinitions[grest.SecurityAPIKey]
+	if bearer.Type != "apiKey" || bearer.Name != "Authorization" || apiKey.Name != grest.APIKeyHeader {
+		t.Fatalf("unexpected security definitions %s", recorder.Body.String())
+	}
+	if scopes := swagger.Paths["/doc"]["post"].Scopes; len(scopes) != 1 || scopes[0] != "doc:write" {
+		t.Fatalf("unexpected scopes of POST /doc %s", recorder.Body.String())
+	}
+}
+
+func TestJWTAuth_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "k1",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	keys, err := grest.ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rs256 := func(b []byte) []byte {
+		digest := sha256.Sum256(b)
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	token := TToken(t, "RS256", "k1", map[string]interface{}{"sub": "u1", "roles": []string{"admin"}, "tenant": "acme", "exp": exp}, rs256)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", "Bearer "+token)
+	principal, err := (&grest.JWTAuth{Keys: keys}).Authenticate(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.ID != "u1" || !principal.HasRole("admin") || principal.Tenant != "acme" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+	if _, err := (&grest.JWTAuth{Secret: []byte("x")}).Authenticate(request); err == nil {
+		t.Fatal("expected error without rsa key")
+	}
+
+	// exp is required unless RequireExp is false
+	noExp := TToken(t, "RS256", "k1", map[string]interface{}{"sub": "u1"}, rs256)
+	if _, err := (&grest.JWTAuth{Keys: keys}).Verify(noExp); err == nil {
+		t.Fatal("expected error of token without exp")
+	}
+	optional := false
+	if _, err := (&grest.JWTAuth{Keys: keys, RequireExp: &optional}).Verify(noExp); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,9 +1,16 @@
 package grest
 
-// View is interface
+// View is data access interface of resource, APIView is the gorm implementation
+// and MemoryView is the in-memory implementation
 type View interface {
-	FindMany(interface{}, map[string]interface{}, *Context) (int, error)
+	FindMany(interface{}, *Filter, *Context) (int, error)
 	Save(interface{}, *Context) error
 	FindOne(interface{}, *Context) error
 	Delete(interface{}, *Context) error
 }
+
+var (
+	_ View = (*APIView)(nil)
+	_ View = (*MemoryView)(nil)
+	_ View = (*CachedView)(nil)
+)
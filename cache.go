@@ -0,0 +1,371 @@
+package grest
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Cache is store of CachedView, entries are tagged with resource names to be invalidated by resource
+// Invalidate increase the generation of the tag, and Set skip the entry if generation of any tag is changed,
+// so the result read before a write is not cached after the write is invalidated
+// LRUCache is the in-process implementation, external stores implement it with e.g. a counter per tag
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	// Generations are current generations of the tags
+	Generations(tags []string) map[string]uint64
+	// Set add the entry tagged with the tags if their generations are still the given ones
+	Set(key string, value []byte, ttl time.Duration, tags map[string]uint64)
+	Invalidate(tag string)
+}
+
+// CacheControl is implemented by views telling Cache-Control header of their reads
+type CacheControl interface {
+	CacheControl(cxt *Context) string
+}
+
+var (
+	_ CacheControl = (*CachedView)(nil)
+	_ Cache        = (*LRUCache)(nil)
+)
+
+// CachedView is View caching FindMany and FindOne of the wrapped View
+// the key is the normalised filter with tenant, row scopes and DBRouter key of the context,
+// Save and Delete invalidate entries of the resource and of the resources preloaded with it.
+// results are cached as JSON, fields without JSON are not restored from the cache, so writes read the stored row past it
+//
+//	view := grest.NewCachedView(new(grest.APIView), grest.NewLRUCache(10000), time.Minute)
+//	api.AddResource(&User{}, grest.ResourceConfig{View: view})
+type CachedView struct {
+	View
+	Cache Cache
+	// TTL is lifetime of entries, 0 is until invalidated
+	TTL time.Duration
+	// MaxAge is max-age of Cache-Control, 0 responds no-cache
+	MaxAge time.Duration
+	// Key partition entries further, e.g. by a request header the results depend on
+	Key func(cxt *Context) string
+}
+
+// NewCachedView is create CachedView of the view
+func NewCachedView(view View, cache Cache, ttl time.Duration) *CachedView {
+	return &CachedView{View: view, Cache: cache, TTL: ttl}
+}
+
+// cachedMany is cache entry of FindMany
+type cachedMany struct {
+	Count int             `json:"count"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// FindMany query data from the cache, the wrapped View is queried on miss
+func (c *CachedView) FindMany(result interface{}, filter *Filter, context *Context) (int, error) {
+	if filter == nil {
+		filter = new(Filter)
+	}
+	key, err := c.cacheKey("many", result, normalizeFilter(filter), context)
+	if err != nil {
+		return 0, err
+	}
+	tags := c.Cache.Generations(cacheTags(result, filter.Preloads))
+	if b, ok := c.get(key, context); ok {
+		entry := cachedMany{}
+		if err := json.Unmarshal(b, &entry); err == nil {
+			if err := json.Unmarshal(entry.Data, result); err == nil {
+				return entry.Count, nil
+			}
+		}
+	}
+	count, err := c.View.FindMany(result, filter, context)
+	if err != nil {
+		return count, err
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		return count, nil
+	}
+	if b, err := json.Marshal(&cachedMany{Count: count, Data: data}); err == nil {
+		c.Cache.Set(key, b, c.TTL, tags)
+	}
+	return count, nil
+}
+
+// FindOne query data from the cache, the wrapped View is queried on miss
+func (c *CachedView) FindOne(result interface{}, context *Context) error {
+	var id string
+	if context != nil {
+		id = context.ResourceID
+	}
+	key, err := c.cacheKey("one", result, id, context)
+	if err != nil {
+		return err
+	}
+	tags := c.Cache.Generations(cacheTags(result, nil))
+	if b, ok := c.get(key, context); ok {
+		if err := json.Unmarshal(b, result); err == nil {
+			return nil
+		}
+	}
+	if err := c.View.FindOne(result, context); err != nil {
+		return err
+	}
+	if b, err := json.Marshal(result); err == nil {
+		c.Cache.Set(key, b, c.TTL, tags)
+	}
+	return nil
+}
+
+// Save save data and invalidate the resource
+func (c *CachedView) Save(result interface{}, context *Context) error {
+	defer c.Cache.Invalidate(ModelType(result).Name())
+	return c.View.Save(result, context)
+}
+
+// Delete delete data and invalidate the resource
+func (c *CachedView) Delete(result interface{}, context *Context) error {
+	defer c.Cache.Invalidate(ModelType(result).Name())
+	return c.View.Delete(result, context)
+}
+
+// CacheControl is private for scoped or authenticated reads, public otherwise
+func (c *CachedView) CacheControl(cxt *Context) string {
+	if c.MaxAge <= 0 {
+		return "no-cache"
+	}
+	maxAge := strconv.Itoa(int(c.MaxAge / time.Second))
+	if cxt != nil && (cxt.Scoped() || cxt.Principal != nil) {
+		return "private, max-age=" + maxAge
+	}
+	return "public, max-age=" + maxAge
+}
+
+// get read the entry unless the request asks for no-cache
+func (c *CachedView) get(key string, cxt *Context) ([]byte, bool) {
+	if cxt != nil && cxt.noCache {
+		return nil, false
+	}
+	if cxt != nil && cxt.Request != nil && cxt.Request.Request != nil &&
+		strings.Contains(cxt.Request.Request.Header.Get("Cache-Control"), "no-cache") {
+		return nil, false
+	}
+	return c.Cache.Get(key)
+}
+
+// cacheKey hash the query with what scopes it in the context
+func (c *CachedView) cacheKey(kind string, result interface{}, query interface{}, cxt *Context) (string, error) {
+	key := struct {
+		Kind      string
+		Resource  string
+		Query     interface{}
+		Tenant    string
+		SuperUser bool
+		RowScopes [][]interface{}
+		DBKey     string
+		Partition string
+	}{Kind: kind, Resource: ModelType(result).String(), Query: query}
+	if cxt != nil {
+		key.Tenant = cxt.TenantID
+		key.DBKey = cxt.DBKey
+		key.SuperUser = cxt.SuperUser
+		key.RowScopes = cxt.RowScopes
+		if c.Key != nil {
+			key.Partition = c.Key(cxt)
+		}
+	}
+	b, err := json.Marshal(&key)
+	if err != nil {
+		return "", fmt.Errorf("cache key: %v", err)
+	}
+	sum := sha256.Sum256(b)
+	return ModelType(result).Name() + ":" + hex.EncodeToString(sum[:]), nil
+}
+
+// normalizeFilter make equivalent filters equal, e.g. fields in other order
+func normalizeFilter(filter *Filter) *Filter {
+	normal := *filter
+	normal.Fields = sortedStrings(filter.Fields)
+	normal.Preloads = sortedStrings(filter.Preloads)
+	normal.Order = strings.Join(strings.Fields(filter.Order), " ")
+	if len(filter.Where) > 0 {
+		normal.Where = append([]interface{}{}, filter.Where...)
+		if cond, ok := normal.Where[0].(string); ok {
+			normal.Where[0] = strings.Join(strings.Fields(cond), " ")
+		}
+	}
+	return &normal
+}
+
+func sortedStrings(strs []string) []string {
+	if len(strs) == 0 {
+		return nil
+	}
+	sorted := append([]string{}, strs...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// cacheTags is name of the model and models of its preloads, e.g. "Company.Users"
+func cacheTags(result interface{}, preloads []string) []string {
+	tags := []string{ModelType(result).Name()}
+	for _, preload := range preloads {
+		typ := ModelType(result)
+		for _, name := range strings.Split(preload, ".") {
+			scope := &gorm.Scope{Value: reflect.New(typ).Interface()}
+			field, ok := scope.FieldByName(name)
+			if !ok {
+				break
+			}
+			typ = field.Struct.Type
+			for typ.Kind() == reflect.Slice || typ.Kind() == reflect.Ptr {
+				typ = typ.Elem()
+			}
+			if !containsString(tags, typ.Name()) {
+				tags = append(tags, typ.Name())
+			}
+		}
+	}
+	return tags
+}
+
+// InvalidateHook is CommitHook invalidating the resource of changes written outside CachedView
+func InvalidateHook(cache Cache) CommitHook {
+	return func(change *Change) {
+		cache.Invalidate(change.Resource)
+	}
+}
+
+// LRUCache is in-process Cache evicting the least recently used entries
+type LRUCache struct {
+	// Size is max number of entries, 0 is unlimited
+	Size int
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+	tags  map[string]map[string]struct{}
+	gens  map[string]uint64
+}
+
+// lruEntry is entry of LRUCache
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+	tags    []string
+}
+
+// NewLRUCache is create LRUCache holding size entries at most
+func NewLRUCache(size int) *LRUCache {
+	return &LRUCache{Size: size}
+}
+
+// Get get the entry and mark it recently used
+func (l *LRUCache) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		l.remove(elem)
+		return nil, false
+	}
+	l.ll.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Generations are current generations of the tags
+func (l *LRUCache) Generations(tags []string) map[string]uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	gens := make(map[string]uint64, len(tags))
+	for _, tag := range tags {
+		gens[tag] = l.gens[tag]
+	}
+	return gens
+}
+
+// Set add or replace the entry if generations of the tags are not changed, ttl 0 never expires
+func (l *LRUCache) Set(key string, value []byte, ttl time.Duration, tags map[string]uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for tag, gen := range tags {
+		if l.gens[tag] != gen {
+			return
+		}
+	}
+	if l.ll == nil {
+		l.ll = list.New()
+		l.items = map[string]*list.Element{}
+		l.tags = map[string]map[string]struct{}{}
+	}
+	if elem, ok := l.items[key]; ok {
+		l.remove(elem)
+	}
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	l.items[key] = l.ll.PushFront(entry)
+	for tag := range tags {
+		entry.tags = append(entry.tags, tag)
+		if l.tags[tag] == nil {
+			l.tags[tag] = map[string]struct{}{}
+		}
+		l.tags[tag][key] = struct{}{}
+	}
+	for l.Size > 0 && l.ll.Len() > l.Size {
+		l.remove(l.ll.Back())
+	}
+}
+
+// Invalidate remove entries of the tag and increase its generation
+func (l *LRUCache) Invalidate(tag string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.gens == nil {
+		l.gens = map[string]uint64{}
+	}
+	l.gens[tag]++
+	for key := range l.tags[tag] {
+		if elem, ok := l.items[key]; ok {
+			l.remove(elem)
+		}
+	}
+	delete(l.tags, tag)
+}
+
+// Len is number of entries
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ll == nil {
+		return 0
+	}
+	return l.ll.Len()
+}
+
+// remove remove the element and its tag references
+func (l *LRUCache) remove(elem *list.Element) {
+	entry := elem.Value.(*lruEntry)
+	l.ll.Remove(elem)
+	delete(l.items, entry.key)
+	for _, tag := range entry.tags {
+		delete(l.tags[tag], entry.key)
+		if len(l.tags[tag]) == 0 {
+			delete(l.tags, tag)
+		}
+	}
+}
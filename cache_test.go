@@ -0,0 +1,123 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestCachedView(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	cache := grest.NewLRUCache(100)
+	view := grest.NewCachedView(new(grest.APIView), cache, time.Minute)
+	view.MaxAge = time.Minute
+	h.AddResource(&Doc{}, grest.ResourceConfig{View: view})
+
+	doc := new(Doc)
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK).JSON(doc)
+	h.GET("/doc").Filter(&grest.Filter{Fields: []string{"title", "id"}}).Expect().Status(http.StatusOK).
+		Header("Cache-Control", "public, max-age=60").Count(1).Contains(`"a"`)
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Contains(`"a"`)
+
+	// written outside grest, the cached results are served
+	h.DB.Model(&Doc{}).Where("id = ?", doc.ID).Update("title", "stale")
+	h.GET("/doc").Filter(&grest.Filter{Fields: []string{"id", "title"}}).Expect().Contains(`"a"`)
+	h.GET("/doc/1").Expect().Contains(`"a"`)
+	h.GET("/doc/1").Header("Cache-Control", "no-cache").Expect().Contains(`"stale"`)
+
+	doc.Title = "b"
+	h.PUT("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	if cache.Len() != 0 {
+		t.Fatalf("expected invalidated cache, got %d entries", cache.Len())
+	}
+	h.GET("/doc").Expect().Count(1).Contains(`"b"`)
+	h.GET("/doc/1").Expect().Contains(`"b"`)
+}
+
+func TestCachedView_Write(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	principal := func(cxt *grest.Context) error {
+		cxt.Principal = &grest.Principal{ID: "w", Roles: []string{"writer"}}
+		return nil
+	}
+	policy := grest.RolePolicy{"writer": {{Resource: "Article", Forbid: []string{"hidden"}}}}
+	view := grest.NewCachedView(new(grest.APIView), grest.NewLRUCache(100), time.Minute)
+	h.AddResource(&Article{}, grest.ResourceConfig{View: view, Hooks: []grest.ContextHook{principal}, Policy: policy})
+	h.DB.Create(&Article{Title: "a", Hidden: "h"})
+	h.GET("/article/1").Expect().Status(http.StatusOK).Contains(`"a"`)
+
+	// the forbidden field is kept from the stored row, not from the cached one missing it
+	h.PUT("/article").JSON(&Article{ID: 1, Title: "b"}).Expect().Status(http.StatusOK)
+	stored := new(Article)
+	h.DB.First(stored)
+	if stored.Title != "b" || stored.Hidden != "h" {
+		t.Fatalf("unexpected article %+v", stored)
+	}
+}
+
+func TestLRUCache(t *testing.T) {
+	cache := grest.NewLRUCache(2)
+	cache.Set("a", []byte("1"), 0, cache.Generations([]string{"A"}))
+	cache.Set("b", []byte("2"), 0, cache.Generations([]string{"B"}))
+	cache.Get("a")
+	cache.Set("c", []byte("3"), time.Nanosecond, cache.Generations([]string{"A", "B"}))
+	if _, ok := cache.Get("b"); ok {
+		t.Fatal("expected b evicted")
+	}
+	time.Sleep(time.Millisecond)
+	if _, ok := cache.Get("c"); ok {
+		t.Fatal("expected c expired")
+	}
+	cache.Invalidate("A")
+	if _, ok := cache.Get("a"); ok || cache.Len() != 0 {
+		t.Fatal("expected a invalidated")
+	}
+	// the entry read before the invalidation is not set
+	gens := cache.Generations([]string{"A", "B"})
+	cache.Invalidate("B")
+	if cache.Set("d", []byte("4"), 0, gens); cache.Len() != 0 {
+		t.Fatal("expected stale d skipped")
+	}
+}
+
+// invalidatingView invalidate the resource while the query is running, as a concurrent write does
+type invalidatingView struct {
+	grest.APIView
+	cache grest.Cache
+}
+
+func (v *invalidatingView) FindOne(result interface{}, context *grest.Context) error {
+	err := v.APIView.FindOne(result, context)
+	v.cache.Invalidate("Doc")
+	return err
+}
+
+func TestCachedView_Concurrent(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	cache := grest.NewLRUCache(100)
+	view := grest.NewCachedView(&invalidatingView{cache: cache}, cache, 0)
+	partition := func(cxt *grest.Context) error {
+		cxt.DBKey = cxt.Request.HeaderParameter("X-DB")
+		return nil
+	}
+	h.AddResource(&Doc{}, grest.ResourceConfig{View: view, Hooks: []grest.ContextHook{partition}})
+	h.DB.Create(&Doc{Title: "a"})
+
+	h.GET("/doc/1").Expect().Status(http.StatusOK)
+	if cache.Len() != 0 {
+		t.Fatalf("expected result read before the write not cached, got %d entries", cache.Len())
+	}
+
+	// entries of routed dbs are not shared
+	view.View = new(grest.APIView)
+	h.GET("/doc/1").Header("X-DB", "a").Expect().Status(http.StatusOK)
+	h.DB.Model(&Doc{}).Where("id = ?", 1).Update("title", "b")
+	h.GET("/doc/1").Header("X-DB", "a").Expect().Contains(`"a"`)
+	h.GET("/doc/1").Header("X-DB", "b").Expect().Contains(`"b"`)
+}
@@ -0,0 +1,100 @@
+package grest
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Change is data written by View
+type Change struct {
+	Action Action
+	// Resource is model name
+	Resource string
+	// ID is primary key, multiple primary values are joined with a comma
+	ID string
+	// Before is stored data before the write, nil on create
+	Before interface{}
+	// After is data after the write, nil on delete
+	After   interface{}
+	Context *Context
+	event   *Event
+}
+
+// WriteHook run in the transaction of the write, the write is rolled back if it fails
+type WriteHook func(tx *gorm.DB, change *Change) error
+
+// CommitHook run after the transaction of the write is committed, e.g. EventBus.Hook
+// NOTE: if the db of context is a transaction already, it runs before the outer commit
+type CommitHook func(change *Change)
+
+// newChange is create Change of the value
+func newChange(action Action, value interface{}, context *Context) *Change {
+	return &Change{Action: action, Resource: ModelType(value).Name(), Context: context}
+}
+
+// runWriteHooks run write hooks of the context
+func runWriteHooks(tx *gorm.DB, changes ...*Change) error {
+	for _, change := range changes {
+		if change.ID == "" {
+			if change.After != nil {
+				change.ID = primaryKeyString(change.After)
+			} else if change.Before != nil {
+				change.ID = primaryKeyString(change.Before)
+			}
+		}
+		for _, hook := range change.Context.WriteHooks {
+			if err := hook(tx, change); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runCommitHooks run commit hooks of the context
+func runCommitHooks(changes ...*Change) {
+	for _, change := range changes {
+		for _, hook := range change.Context.CommitHooks {
+			hook(change)
+		}
+	}
+}
+
+// transaction run fn in a transaction, the transaction of db is reused
+func transaction(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return fn(db)
+	}
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// primaryKeyString get primary key of the value as string
+func primaryKeyString(value interface{}) string {
+	scope := gorm.Scope{Value: value}
+	var id string
+	for i, field := range scope.PrimaryFields() {
+		if i > 0 {
+			id += ","
+		}
+		id += fmt.Sprint(field.Field.Interface())
+	}
+	return id
+}
+
+// copyValue copy struct of the pointer, so later writes do not change it
+func copyValue(value interface{}) interface{} {
+	copied := reflect.New(ModelType(value))
+	copied.Elem().Set(Indirect(reflect.ValueOf(value)))
+	return copied.Interface()
+}
@@ -0,0 +1,84 @@
+package grest
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/emicklei/go-restful"
+	"github.com/vmihailenco/msgpack/v4"
+)
+
+// MIME types of the codecs registered by grest
+const (
+	MIMEForm      = "application/x-www-form-urlencoded"
+	MIMEMultipart = "multipart/form-data"
+	MIMEMsgpack   = "application/x-msgpack"
+)
+
+// maxMultipartMemory is the memory limit used when parsing multipart forms
+var maxMultipartMemory int64 = 32 << 20
+
+func init() {
+	RegisterCodec(MIMEForm, NewFormCodec())
+	RegisterCodec(MIMEMultipart, NewFormCodec())
+	RegisterCodec(MIMEMsgpack, NewMsgpackCodec(MIMEMsgpack))
+}
+
+// Codec reads and writes entities of a MIME type
+type Codec = restful.EntityReaderWriter
+
+// RegisterCodec register codec for the MIME type, it overrides the existing one
+// JSON and XML are registered by go-restful
+func RegisterCodec(mime string, codec Codec) {
+	restful.RegisterEntityAccessor(mime, codec)
+}
+
+// formCodec is form codec, it can only read entities
+type formCodec struct{}
+
+// NewFormCodec is create form codec for url-encoded and multipart forms
+func NewFormCodec() Codec {
+	return formCodec{}
+}
+
+// Read decode form into v
+func (formCodec) Read(req *restful.Request, v interface{}) error {
+	if err := req.Request.ParseMultipartForm(maxMultipartMemory); err != nil && err != http.ErrNotMultipart {
+		return err
+	}
+	if req.Request.MultipartForm != nil {
+		return DecodeForm(req.Request.MultipartForm.Value, v)
+	}
+	return DecodeForm(req.Request.PostForm, v)
+}
+
+// Write is not supported by form codec
+func (formCodec) Write(resp *restful.Response, status int, v interface{}) error {
+	return errors.New("form codec can not write entity")
+}
+
+// msgpackCodec is MessagePack codec, it uses json tag
+type msgpackCodec struct {
+	contentType string
+}
+
+// NewMsgpackCodec is create MessagePack codec
+func NewMsgpackCodec(contentType string) Codec {
+	return msgpackCodec{contentType: contentType}
+}
+
+// Read decode MessagePack into v
+func (c msgpackCodec) Read(req *restful.Request, v interface{}) error {
+	return msgpack.NewDecoder(req.Request.Body).UseJSONTag(true).Decode(v)
+}
+
+// Write encode v as MessagePack
+func (c msgpackCodec) Write(resp *restful.Response, status int, v interface{}) error {
+	if v == nil {
+		resp.WriteHeader(status)
+		return nil
+	}
+	resp.Header().Set(restful.HEADER_ContentType, c.contentType)
+	resp.WriteHeader(status)
+	return msgpack.NewEncoder(resp).UseJSONTag(true).Encode(v)
+}
@@ -1,6 +1,8 @@
 package grest
 
 import (
+	"context"
+
 	"github.com/emicklei/go-restful"
 	"github.com/jinzhu/gorm"
 )
@@ -11,8 +13,34 @@ type Context struct {
 	ResourceID string
 	Request    *restful.Request
 	Response   *restful.Response
+	// ReadDB serve queries if set, e.g. a replica chosen by ReplicaPool, writes use DB
+	ReadDB *gorm.DB
+	// DBKey is routing key of DB set by DBRouter, empty is the default db
+	DBKey string
+	// TenantID scope the queries to rows of the tenant, see TenantColumn
+	TenantID string
+	// SuperUser bypass the tenant scope
+	SuperUser bool
+	// Principal is the authenticated caller, nil is anonymous
+	Principal *Principal
+	// RowScopes are where conditions added by Policy, e.g. []interface{}{"owner_id = ?", 1}
+	RowScopes [][]interface{}
+	// Mask are fields masked by Policy, they are reset in payloads of change events
+	Mask []string
+	// WriteHooks run in the transaction of APIView writes, e.g. Audit.Hook
+	WriteHooks []WriteHook
+	// CommitHooks run after APIView writes are committed, e.g. EventBus.Hook
+	CommitHooks []CommitHook
+	// spanContext is context of the current span, see SpanContext
+	spanContext context.Context
+	// noCache read past CachedView, e.g. the stored row of a write
+	noCache bool
 }
 
+// ContextHook prepare the context of current request, e.g. resolve the tenant
+// an error stops the request, the status of HTTPError is responded
+type ContextHook func(cxt *Context) error
+
 // Clone clone current context
 func (context *Context) Clone() *Context {
 	var clone = *context
@@ -24,8 +52,26 @@ func (context *Context) GetDB() *gorm.DB {
 	return context.DB
 }
 
+// GetReadDB get db of queries, it is DB if ReadDB is not set
+func (context *Context) GetReadDB() *gorm.DB {
+	if context.ReadDB != nil {
+		return context.ReadDB
+	}
+	return context.DB
+}
+
 // SetDB set db into current context
 func (context *Context) SetDB(db *gorm.DB) *Context {
 	context.DB = db
 	return context
 }
+
+// Scoped is whether queries of current context are constrained by tenant or row scopes
+func (context *Context) Scoped() bool {
+	return context.TenantScoped() || (context != nil && len(context.RowScopes) > 0)
+}
+
+// TenantScoped is whether queries of current context are scoped by tenant
+func (context *Context) TenantScoped() bool {
+	return context != nil && context.TenantID != "" && !context.SuperUser
+}
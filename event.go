@@ -0,0 +1,145 @@
+package grest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// EventType is type of change event
+type EventType string
+
+// Types of change event
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+)
+
+// Event is change of a resource
+type Event struct {
+	ID         string                 `json:"id"`
+	Type       EventType              `json:"type"`
+	Resource   string                 `json:"resource"`
+	ResourceID string                 `json:"resourceId"`
+	TenantID   string                 `json:"tenantId,omitempty"`
+	Actor      string                 `json:"actor,omitempty"`
+	Payload    json.RawMessage        `json:"payload"`
+	Diff       map[string]FieldChange `json:"diff,omitempty"`
+	Time       time.Time              `json:"time"`
+}
+
+// Event is event of the change, payload is data after the write, or before on delete
+// it is created once, so write and commit hooks share the event id
+func (change *Change) Event() (*Event, error) {
+	if change.event != nil {
+		return change.event, nil
+	}
+	event := &Event{ID: newEventID(), Resource: change.Resource, ResourceID: change.ID, Time: time.Now()}
+	// fields masked by the policy are not published
+	before, after := change.Before, change.After
+	if cxt := change.Context; cxt != nil && len(cxt.Mask) > 0 {
+		before, after = maskedCopy(before, cxt.Mask), maskedCopy(after, cxt.Mask)
+	}
+	data := after
+	switch change.Action {
+	case ActionCreate:
+		event.Type = EventCreated
+	case ActionDelete:
+		event.Type = EventDeleted
+		data = before
+	default:
+		event.Type = EventUpdated
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	event.Payload = payload
+	if event.Type == EventUpdated {
+		if event.Diff, err = AuditDiff(before, after); err != nil {
+			return nil, err
+		}
+	}
+	if cxt := change.Context; cxt != nil {
+		event.TenantID = cxt.TenantID
+		if cxt.Principal != nil {
+			event.Actor = cxt.Principal.ID
+		}
+	}
+	change.event = event
+	return event, nil
+}
+
+// maskedCopy is copy of the value with masked fields reset
+func maskedCopy(value interface{}, mask []string) interface{} {
+	if rv := reflect.ValueOf(value); !rv.IsValid() || (rv.Kind() == reflect.Ptr && rv.IsNil()) {
+		return value
+	}
+	copied := copyValue(value)
+	maskFields(copied, mask)
+	return copied
+}
+
+// newEventID is random event id
+func newEventID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// EventBus is in-process publisher of events
+//
+//	bus := grest.NewEventBus()
+//	api.Context.CommitHooks = append(api.Context.CommitHooks, bus.Hook())
+//	bus.Subscribe(func(event *grest.Event) { ... })
+type EventBus struct {
+	mu          sync.RWMutex
+	seq         int
+	subscribers map[int]func(event *Event)
+}
+
+// NewEventBus is create EventBus
+func NewEventBus() *EventBus {
+	return &EventBus{subscribers: map[int]func(event *Event){}}
+}
+
+// Subscribe add the handler, the returned function remove it
+// handlers are called synchronously in the writing request, slow work should be queued
+func (b *EventBus) Subscribe(handler func(event *Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	id := b.seq
+	b.subscribers[id] = handler
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// Publish call handlers with the event
+func (b *EventBus) Publish(event *Event) {
+	b.mu.RLock()
+	handlers := make([]func(event *Event), 0, len(b.subscribers))
+	for _, handler := range b.subscribers {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Hook is CommitHook publishing event of the change
+func (b *EventBus) Hook() CommitHook {
+	return func(change *Change) {
+		if event, err := change.Event(); err == nil {
+			b.Publish(event)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package grest_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestEventsAndWebhooks(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	webhooks := grest.NewWebhooks(h.DB)
+	webhooks.Backoff = func(int) time.Duration { return 0 }
+	if err := webhooks.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	bus := grest.NewEventBus()
+	var events []*grest.Event
+	bus.Subscribe(func(event *grest.Event) {
+		if event.Resource == "Doc" {
+			events = append(events, event)
+		}
+	})
+	h.API.Context.WriteHooks = []grest.WriteHook{webhooks.Hook()}
+	h.API.Context.CommitHooks = []grest.CommitHook{bus.Hook(), webhooks.Notify()}
+	h.AddResource(&Doc{})
+	if _, err := h.API.AddWebhookResource(); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu       sync.Mutex
+		received []grest.Event
+		calls    int
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		signature := "sha256=" + grest.SignWebhook("s3cret", r.Header.Get(grest.HeaderWebhookTimestamp), body)
+		if r.Header.Get(grest.HeaderWebhookSignature) != signature {
+			t.Errorf("invalid signature %q", r.Header.Get(grest.HeaderWebhookSignature))
+		}
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		event := grest.Event{}
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+	}))
+	defer receiver.Close()
+	// private addresses are refused by default
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: receiver.URL}).Expect().Status(http.StatusBadRequest)
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: "http://169.254.169.254/latest/meta-data"}).Expect().Status(http.StatusBadRequest)
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: "http://localhost/"}).Expect().Status(http.StatusBadRequest)
+	grest.WebhookPrivate = true
+	defer func() { grest.WebhookPrivate = false }()
+	subscription := new(grest.WebhookSubscription)
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: receiver.URL, Secret: "s3cret", Events: "updated"}).Expect().
+		Status(http.StatusOK).JSON(subscription)
+	// the secret is write only
+	subscription.Resources = "Doc"
+	h.PUT("/webhooks").JSON(subscription).Expect().Status(http.StatusOK)
+	if body := h.GET("/webhooks").Expect().Status(http.StatusOK).Count(1).Body(); strings.Contains(string(body), "s3cret") {
+		t.Fatal("secret is responded")
+	}
+	// the url is http or https of allowed hosts
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: "file:///etc/passwd"}).Expect().Status(http.StatusBadRequest)
+	grest.WebhookHosts = []string{".example.com"}
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: "http://198.51.100.1/"}).Expect().Status(http.StatusBadRequest)
+	h.POST("/webhooks").JSON(&grest.WebhookSubscription{URL: "https://hooks.example.com/"}).Expect().Status(http.StatusOK)
+	h.DB.Delete(&grest.WebhookSubscription{}, "url = ?", "https://hooks.example.com/")
+	grest.WebhookHosts = nil
+
+	doc := new(Doc)
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK).JSON(doc)
+	doc.Title = "b"
+	h.PUT("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	h.DELETE("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	if len(events) != 3 || events[1].Type != grest.EventUpdated || events[1].Diff["title"].After != "b" || events[2].Type != grest.EventDeleted {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := webhooks.Dispatch(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 2 || len(received) != 1 || received[0].ID != events[1].ID || !strings.Contains(string(received[0].Payload), `"b"`) {
+		t.Fatalf("unexpected deliveries %d %+v", calls, received)
+	}
+	delivery := new(grest.WebhookDelivery)
+	h.DB.First(delivery)
+	if delivery.Status != grest.DeliveryDelivered || delivery.Attempts != 2 {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, "/internal", http.StatusFound)
+		}
+	}))
+	defer receiver.Close()
+	client := grest.NewWebhooks(nil).Client
+
+	// the resolved address is checked when connecting
+	if _, err := client.Get(strings.Replace(receiver.URL, "127.0.0.1", "localhost", 1)); err == nil {
+		t.Fatal("expected error of private address")
+	}
+	grest.WebhookPrivate = true
+	defer func() { grest.WebhookPrivate = false }()
+	response, err := client.Get(receiver.URL + "/redirect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	// redirects are not followed
+	if response.StatusCode != http.StatusFound {
+		t.Fatalf("unexpected status %d", response.StatusCode)
+	}
+}
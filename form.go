@@ -0,0 +1,272 @@
+package grest
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxFormIndex is max slice index of form keys, larger indexes are rejected with 400
+var MaxFormIndex = 1000
+
+// MaxFormElements is max slice elements allocated by decoding one form, more are rejected with 400
+var MaxFormElements = 10000
+
+// DecodeForm decode form values into v, v must be a pointer to struct
+// keys may address nested fields and slice elements by json name or field name
+// e.g. "name", "company.name", "users[0].name", "tags[1]"
+func DecodeForm(form url.Values, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("form decode target must be a non-nil pointer, got %T", v)
+	}
+
+	keys := make([]string, 0, len(form))
+	for key := range form {
+		keys = append(keys, key)
+	}
+	// sort keys so that slice elements are filled by index order
+	SortFormKeys(keys)
+
+	elements := 0
+	for _, key := range keys {
+		path, err := parseFormKey(key)
+		if err != nil {
+			return err
+		}
+		if err := setFormValue(rv.Elem(), path, form[key], &elements); err != nil {
+			if isHTTPError(err) {
+				return err
+			}
+			return fmt.Errorf("form key %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// formKeyPart is a segment of form key, either a field name or a slice index
+type formKeyPart struct {
+	name  string
+	index int
+}
+
+// parseFormKey split "users[0].name" into users, [0], name
+func parseFormKey(key string) ([]formKeyPart, error) {
+	var parts []formKeyPart
+	for _, segment := range strings.Split(key, ".") {
+		name := segment
+		if i := strings.Index(segment, "["); i >= 0 {
+			name = segment[:i]
+		}
+		if name != "" {
+			parts = append(parts, formKeyPart{name: name, index: -1})
+		}
+		rest := segment[len(name):]
+		for rest != "" {
+			end := strings.Index(rest, "]")
+			if rest[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("form key %s format is incorrect", key)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, NewHTTPError(http.StatusBadRequest, fmt.Errorf("form key %s index is incorrect", key))
+			}
+			if index > MaxFormIndex {
+				return nil, NewHTTPError(http.StatusBadRequest, fmt.Errorf("form key %s index exceeds %d", key, MaxFormIndex))
+			}
+			parts = append(parts, formKeyPart{index: index})
+			rest = rest[end+1:]
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("form key %s is empty", key)
+	}
+	return parts, nil
+}
+
+// setFormValue walks path from v and sets the values to the last field, elements count the allocated slice elements
+func setFormValue(v reflect.Value, path []formKeyPart, values []string, elements *int) error {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if len(path) == 0 {
+		if v.Kind() == reflect.Slice && !isTextValue(v) {
+			slice := reflect.MakeSlice(v.Type(), len(values), len(values))
+			for i, value := range values {
+				if err := setFormScalar(slice.Index(i), value); err != nil {
+					return err
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		return setFormScalar(v, values[len(values)-1])
+	}
+
+	part := path[0]
+	if part.name == "" {
+		if v.Kind() != reflect.Slice {
+			return fmt.Errorf("%v is not a slice", v.Type())
+		}
+		if part.index >= v.Len() {
+			if *elements += part.index + 1 - v.Len(); *elements > MaxFormElements {
+				return NewHTTPError(http.StatusBadRequest, fmt.Errorf("form elements exceed %d", MaxFormElements))
+			}
+			grown := reflect.MakeSlice(v.Type(), part.index+1, part.index+1)
+			reflect.Copy(grown, v)
+			v.Set(grown)
+		}
+		return setFormValue(v.Index(part.index), path[1:], values, elements)
+	}
+
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("%v is not a struct", v.Type())
+	}
+	field, ok := formField(v, part.name)
+	if !ok {
+		// unknown keys are ignored like json does
+		return nil
+	}
+	return setFormValue(field, path[1:], values, elements)
+}
+
+// formField find the field by json name or field name, embedded structs are searched as well
+func formField(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" && !sf.Anonymous {
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if tag == name || (tag == "" && strings.EqualFold(sf.Name, name)) {
+			return v.Field(i), true
+		}
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.Anonymous || sf.Tag.Get("json") != "" {
+			continue
+		}
+		field := v.Field(i)
+		if field.Kind() == reflect.Ptr {
+			if field.Type().Elem().Kind() != reflect.Struct {
+				continue
+			}
+			if field.IsNil() {
+				field.Set(reflect.New(field.Type().Elem()))
+			}
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Struct {
+			if f, ok := formField(field, name); ok {
+				return f, true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+)
+
+// isTextValue check v can be set from a single string
+func isTextValue(v reflect.Value) bool {
+	return v.Type() == timeType || reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) || v.Type() == reflect.TypeOf([]byte(nil))
+}
+
+// setFormScalar set a single form value to v
+func setFormScalar(v reflect.Value, value string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		if value == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+		t, err := ParseTime(value, nil)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		if value == "" || value == "on" {
+			v.SetBool(value == "on")
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			v.SetInt(0)
+			return nil
+		}
+		i, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			v.SetUint(0)
+			return nil
+		}
+		u, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			v.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("can not set %v from a single value", v.Type())
+		}
+		v.SetBytes([]byte(value))
+	default:
+		return fmt.Errorf("can not set %v from form value", v.Type())
+	}
+	return nil
+}
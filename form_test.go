@@ -0,0 +1,98 @@
+package grest_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type FormUser struct {
+	Name string   `json:"name"`
+	Age  int      `json:"age"`
+	Tags []string `json:"tags"`
+}
+
+type FormCompany struct {
+	CompanyName string     `json:"companyName"`
+	Active      bool       `json:"active"`
+	Owner       *FormUser  `json:"owner"`
+	Users       []FormUser `json:"users"`
+}
+
+func TestDecodeForm(t *testing.T) {
+	form := url.Values{
+		"companyName":      {"grest"},
+		"active":           {"true"},
+		"owner.name":       {"boss"},
+		"users[10].name":   {"k"},
+		"users[2].name":    {"c"},
+		"users[0].name":    {"a"},
+		"users[0].age":     {"18"},
+		"users[0].tags":    {"x", "y"},
+		"users[2].tags[1]": {"z"},
+		"unknown":          {"ignored"},
+	}
+	company := new(FormCompany)
+	if err := grest.DecodeForm(form, company); err != nil {
+		t.Fatal(err)
+	}
+	if company.CompanyName != "grest" || !company.Active {
+		t.Fatalf("unexpected company %+v", company)
+	}
+	if company.Owner == nil || company.Owner.Name != "boss" {
+		t.Fatalf("unexpected owner %+v", company.Owner)
+	}
+	if len(company.Users) != 11 {
+		t.Fatalf("unexpected users length %d", len(company.Users))
+	}
+	if u := company.Users[0]; u.Name != "a" || u.Age != 18 || len(u.Tags) != 2 || u.Tags[1] != "y" {
+		t.Fatalf("unexpected users[0] %+v", u)
+	}
+	if u := company.Users[2]; u.Name != "c" || len(u.Tags) != 2 || u.Tags[1] != "z" {
+		t.Fatalf("unexpected users[2] %+v", u)
+	}
+	if company.Users[10].Name != "k" {
+		t.Fatalf("unexpected users[10] %+v", company.Users[10])
+	}
+}
+
+func TestDecodeForm_Error(t *testing.T) {
+	if err := grest.DecodeForm(url.Values{"age": {"old"}}, new(FormUser)); err == nil {
+		t.Fatal("expected error for non-numeric age")
+	}
+	if err := grest.DecodeForm(url.Values{"users[x].name": {"a"}}, new(FormCompany)); err == nil {
+		t.Fatal("expected error for bad index")
+	}
+	for _, key := range []string{"users[9000000000000000000].name", "users[1001].name", "users[0].tags[5000]"} {
+		if err := grest.DecodeForm(url.Values{key: {"a"}}, new(FormCompany)); err == nil {
+			t.Fatalf("expected error for index of %s", key)
+		}
+	}
+}
+
+func TestFormIndexLimit(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	h.AddResource(&Doc{}, grest.ResourceConfig{Consumes: []string{restful.MIME_JSON, grest.MIMEForm}})
+
+	h.POST("/doc").Form(url.Values{"title": {"a"}}).Expect().Status(http.StatusOK).Contains(`"title": "a"`)
+	h.POST("/doc").Form(url.Values{"title": {"a"}, "tags[9000000000000000000]": {"x"}}).Expect().Status(http.StatusBadRequest)
+
+	// indexes under the limit can not allocate more elements than MaxFormElements in total
+	form := url.Values{}
+	for i := 0; i < 9; i++ {
+		form.Set(fmt.Sprintf("users[%d].tags[1000]", i), "x")
+	}
+	if err := grest.DecodeForm(form, new(FormCompany)); err != nil {
+		t.Fatal(err)
+	}
+	form.Set("users[9].tags[1000]", "x")
+	if err := grest.DecodeForm(form, new(FormCompany)); err == nil {
+		t.Fatal("expected error of too many form elements")
+	}
+}
@@ -1,11 +1,8 @@
 package grest
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"reflect"
-	"strconv"
 	"strings"
 
 	"github.com/emicklei/go-restful"
@@ -24,166 +21,291 @@ type Generic interface {
 	WebService(urlPath string)
 }
 
+// GenericReader is service interface reading one data and the schema of the resource
+type GenericReader interface {
+	FindByID(request *restful.Request, response *restful.Response)
+	FindSchema(request *restful.Request, response *restful.Response)
+}
+
+var (
+	_ Generic       = (*GenericAPIView)(nil)
+	_ GenericReader = (*GenericAPIView)(nil)
+)
+
 // FilterFunction is filter function
 type FilterFunction func()
 
 // GenericAPIView is model
 type GenericAPIView struct {
 	APIView
+	// View is data access of the handlers, the embedded APIView is used if nil
+	View             View
 	cxt              *Context
 	WS               *restful.WebService
 	Value            interface{}
 	NewStruct        interface{}
 	NewSlice         interface{}
+	Consumes         []string
+	Produces         []string
+	Methods          []string
+	Hooks            []ContextHook
+	Policy           Policy
+	Scopes           map[Action][]string
+	History          *History
+	Stream           *Stream
 	containerFilters FilterFunction
+	model            model
 }
 
-// Init is GenericAPIView init
+// Init is GenericAPIView init, values of the model are created by reflection
 func (g *GenericAPIView) Init(cxt *Context, value interface{}) {
+	var m model
+	if value != nil {
+		m = reflectModel{value: value}
+	}
+	g.init(cxt, value, m)
+}
+
+// init initialize the view with the model creating values of the resource, see Repository
+func (g *GenericAPIView) init(cxt *Context, value interface{}, m model) {
 	g.cxt = cxt
 	g.WS = new(restful.WebService)
 	g.Value = value
+	g.model = m
 
-	if value != nil {
+	if m != nil {
 		// NewStruct initialize a struct for the Resource
-		g.NewStruct = reflect.New(Indirect(reflect.ValueOf(value)).Type()).Interface()
+		g.NewStruct = m.newOne()
 
 		// NewSlice initialize a slice of struct for the Resource
-		sliceType := reflect.SliceOf(reflect.TypeOf(value))
-		slice := reflect.MakeSlice(sliceType, 0, 0)
-		slicePtr := reflect.New(sliceType)
-		slicePtr.Elem().Set(slice)
-		g.NewSlice = slicePtr.Interface()
+		g.NewSlice = m.newSlice()
+	}
+}
+
+// view is data access of the handlers, View or the embedded APIView
+func (g *GenericAPIView) view() View {
+	if g.View != nil {
+		return g.View
 	}
+	return &g.APIView
+}
+
+// FindMany query data by View, or by the embedded APIView if View is nil
+func (g *GenericAPIView) FindMany(result interface{}, filter *Filter, context *Context) (int, error) {
+	return g.view().FindMany(result, filter, context)
 }
 
+// FindOne query data by View, or by the embedded APIView if View is nil
+func (g *GenericAPIView) FindOne(result interface{}, context *Context) error {
+	return g.view().FindOne(result, context)
+}
+
+// Save save data by View, or by the embedded APIView if View is nil
+func (g *GenericAPIView) Save(result interface{}, context *Context) error {
+	return g.view().Save(result, context)
+}
+
+// Delete delete data by View, or by the embedded APIView if View is nil
+func (g *GenericAPIView) Delete(result interface{}, context *Context) error {
+	return g.view().Delete(result, context)
+}
+
+// Route metadata keys of resource routes, the values are model name and Action
+const (
+	KeyResource = "grest.resource"
+	KeyAction   = "grest.action"
+)
+
 // WebService is create web service
 func (g *GenericAPIView) WebService(urlPath string) {
 	if g.WS == nil {
 		g.WS = new(restful.WebService)
 	}
-	g.WS.Path(fmt.Sprintf("/%s", urlPath)).Consumes(restful.MIME_JSON).Produces(restful.MIME_JSON)
-	tags := []string{reflect.TypeOf(g.Value).Name()}
-	g.WS.Route(g.WS.GET("").To(g.FindFilter).
-		Param(g.WS.QueryParameter("filter", `Filter defining withCount, include, fields, where, order, offset, and limit - must be a JSON-encoded string ({"something":"value"})`).DataType("string").Required(false)).
-		Doc("query filter").Metadata(restfulspec.KeyOpenAPITags, tags).
-		Returns(http.StatusOK, "query success", g.NewSlice))
+	consumes, produces := g.Consumes, g.Produces
+	if len(consumes) == 0 {
+		consumes = []string{restful.MIME_JSON}
+	}
+	if len(produces) == 0 {
+		produces = []string{restful.MIME_JSON}
+	}
+	g.WS.Path(fmt.Sprintf("/%s", urlPath)).Consumes(consumes...).Produces(produces...)
+	tags := []string{ModelType(g.Value).Name()}
+	route := func(action Action, builder *restful.RouteBuilder) {
+		if !g.allowMethod(builder.Build().Method) {
+			return
+		}
+		builder.Metadata(KeyResource, tags[0]).Metadata(KeyAction, action)
+		if scopes := g.Scopes[action]; len(scopes) > 0 {
+			returnsErrors(builder.Metadata(KeyScopes, scopes), http.StatusUnauthorized, http.StatusForbidden)
+		}
+		g.WS.Route(builder)
+	}
+	countHeader := map[string]restful.Header{
+		"count": {Items: &restful.Items{Type: "integer"}, Description: "total count of the filtered data"},
+	}
+	route(ActionList, returnsErrors(g.WS.GET("").To(g.FindFilter).
+		Param(g.WS.QueryParameter("filter", `Filter defining withCount, preloads, fields, where, order, offset, and limit - must be a JSON-encoded string ({"something":"value"})`).DataType("string").DataFormat("json").Required(false)).
+		Doc("query filter").Metadata(restfulspec.KeyOpenAPITags, tags).Metadata(KeyFilterModel, g.Value).
+		ReturnsWithHeaders(http.StatusOK, "query success", g.NewSlice, countHeader), http.StatusBadRequest, http.StatusInternalServerError))
+
+	route("", g.WS.GET("/_schema").To(g.FindSchema).
+		Doc("resource schema").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "query success", ResourceSchema{}))
+
+	route(ActionRead, returnsErrors(g.WS.GET("/{id}").To(g.FindByID).
+		Param(g.WS.PathParameter("id", "primary key, multiple primary values are joined with a comma").DataType("string")).
+		Doc("query by id").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "query success", g.NewStruct), http.StatusNotFound, http.StatusInternalServerError))
 
-	g.WS.Route(g.WS.POST("").To(g.SaveOne).
+	route(ActionCreate, returnsErrors(g.WS.POST("").To(g.SaveOne).
 		Reads(g.Value, "model").
 		Doc("save").Metadata(restfulspec.KeyOpenAPITags, tags).
-		Returns(http.StatusOK, "save success", g.NewStruct))
+		Returns(http.StatusOK, "save success", g.NewStruct), http.StatusInternalServerError))
 
-	g.WS.Route(g.WS.DELETE("").To(g.DeleteOne).
+	route(ActionDelete, returnsErrors(g.WS.DELETE("").To(g.DeleteOne).
 		Reads(g.Value, "model").
 		Doc("delete").Metadata(restfulspec.KeyOpenAPITags, tags).
-		Returns(http.StatusOK, "delete success", g.NewStruct))
+		Returns(http.StatusOK, "delete success", DeleteMsg{}), http.StatusNotFound, http.StatusInternalServerError))
 
-	g.WS.Route(g.WS.PUT("").To(g.ReplaceOne).
+	route(ActionUpdate, returnsErrors(g.WS.PUT("").To(g.ReplaceOne).
 		Reads(g.Value, "model").
-		Doc("replace").Metadata(restfulspec.KeyOpenAPITags, tags).
-		Returns(http.StatusOK, "replace success", g.NewStruct))
+		Doc("replace, or upsert one or an array of data with onConflict").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Param(g.WS.QueryParameter("onConflict", "comma separated conflict columns having a unique index")).
+		Param(g.WS.QueryParameter("update", "comma separated columns updated on conflict, default is all")).
+		Returns(http.StatusOK, "replace success", g.NewStruct), http.StatusNotFound, http.StatusInternalServerError))
 
-	g.WS.Route(g.WS.PATCH("").To(g.UpdateOne).
+	route(ActionUpdate, returnsErrors(g.WS.PATCH("").To(g.UpdateOne).
 		Reads(g.Value, "model").
 		Doc("update").Metadata(restfulspec.KeyOpenAPITags, tags).
-		Returns(http.StatusOK, "update success", g.NewStruct))
+		Returns(http.StatusOK, "update success", g.NewStruct), http.StatusNotFound, http.StatusInternalServerError))
+
+	if g.History != nil {
+		g.versionRoutes(route, tags)
+	}
+	if g.Stream != nil {
+		g.streamRoute(route, tags)
+	}
 
 }
 
-// FindFilter adds a request function to handle GET request.
-func (g *GenericAPIView) FindFilter(request *restful.Request, response *restful.Response) {
-	//http.Error(g.cxt.Response, "Method Not Allowed", 405)
-	filter := strings.TrimSpace(request.QueryParameter("filter"))
-	filterMap := new(Filter)
-	if filter != "" {
-		err := json.Unmarshal([]byte(filter), filterMap)
-		if err != nil {
-			response.WriteHeaderAndEntity(http.StatusBadRequest, NewErrorMsg(http.StatusBadRequest, "query data", err.Error()))
-			return
+// allowMethod check the http method is registered, all methods are registered if Methods is empty
+func (g *GenericAPIView) allowMethod(method string) bool {
+	if len(g.Methods) == 0 {
+		return true
+	}
+	for _, m := range g.Methods {
+		if strings.EqualFold(m, method) {
+			return true
 		}
 	}
-	sliceType := reflect.SliceOf(reflect.TypeOf(g.Value))
-	slice := reflect.MakeSlice(sliceType, 0, 0)
-	slicePtr := reflect.New(sliceType)
-	slicePtr.Elem().Set(slice)
-	results := slicePtr.Interface()
-	count, err := g.FindMany(results, filterMap, g.cxt)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "query data", err.Error()))
-		return
+	return false
+}
+
+// returnsErrors declare error responses of the route with ErrorMsg model
+func returnsErrors(builder *restful.RouteBuilder, codes ...int) *restful.RouteBuilder {
+	for _, code := range codes {
+		builder.Returns(code, http.StatusText(code), ErrorMsg{})
 	}
-	response.AddHeader("count", strconv.Itoa(count))
-	response.WriteAsJson(results)
+	return builder
 }
 
-// SaveOne adds a request function to handle POST request.
-func (g *GenericAPIView) SaveOne(request *restful.Request, response *restful.Response) {
-	//http.Error(g.cxt.Response, "Method Not Allowed", 405)
-	result := reflect.New(Indirect(reflect.ValueOf(g.Value)).Type()).Interface()
-	err := request.ReadEntity(result)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "save data", err.Error()))
-		return
+// newContext clone the context for current request and run the hooks
+// the db put into request context by middleware has priority, see GetDBFromRequest
+func (g *GenericAPIView) newContext(request *restful.Request, response *restful.Response) (*Context, error) {
+	cxt := new(Context)
+	if g.cxt != nil {
+		cxt = g.cxt.Clone()
 	}
-	err = g.Save(result, g.cxt)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "save data", err.Error()))
-		return
+	cxt.Request = request
+	cxt.Response = response
+	cxt.ResourceID = request.PathParameter("id")
+	if db := GetDBFromRequest(request.Request); db != nil {
+		cxt.SetDB(db)
+	}
+	if principal := PrincipalFromRequest(request.Request); principal != nil {
+		cxt.Principal = principal
 	}
-	response.WriteAsJson(result)
+	if g.History != nil {
+		cxt.WriteHooks = append(cxt.WriteHooks[:len(cxt.WriteHooks):len(cxt.WriteHooks)], g.History.Hook())
+	}
+	if g.Stream != nil {
+		cxt.CommitHooks = append(cxt.CommitHooks[:len(cxt.CommitHooks):len(cxt.CommitHooks)], g.Stream.Hook())
+	}
+	for _, hook := range g.Hooks {
+		if err := hook(cxt); err != nil {
+			return nil, err
+		}
+	}
+	return cxt, nil
 }
 
-// DeleteOne adds a request function to handle DELETE request.
-func (g *GenericAPIView) DeleteOne(request *restful.Request, response *restful.Response) {
-	//http.Error(g.cxt.Response, "Method Not Allowed", 405)
-	//result := g.NewStruct
-	result := reflect.New(Indirect(reflect.ValueOf(g.Value)).Type()).Interface()
-	err := request.ReadEntity(result)
+// handle run the handler with context of current request
+func (g *GenericAPIView) handle(request *restful.Request, response *restful.Response, handler func(cxt *Context) *Result) {
+	cxt, err := g.newContext(request, response)
 	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "delete data", err.Error()))
+		writeResult(response, errorResult(http.StatusBadRequest, "request context", err))
 		return
 	}
-	err = g.Delete(result, g.cxt)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "delete data", err.Error()))
-		return
+	var action string
+	if route := selectedRoute(request); route != nil {
+		_, action = routeLabels(route)
 	}
-	response.WriteAsJson(NewDeleteMsg(1))
+	writeResult(response, g.traceHandler(cxt, Action(action), handler))
 }
 
-// ReplaceOne adds a request function to handle PUT request.
-func (g *GenericAPIView) ReplaceOne(request *restful.Request, response *restful.Response) {
-	//http.Error(g.cxt.Response, "Method Not Allowed", 405)
-	//result := g.NewStruct
-	result := reflect.New(Indirect(reflect.ValueOf(g.Value)).Type()).Interface()
-	err := request.ReadEntity(result)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "replace data", err.Error()))
-		return
+// writeResult write handler result into restful response
+func writeResult(response *restful.Response, result *Result) {
+	for key, values := range result.Header {
+		for _, value := range values {
+			response.AddHeader(key, value)
+		}
 	}
-	err = g.Save(result, g.cxt)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "replace data", err.Error()))
+	if result.Entity == nil {
+		response.WriteHeader(result.Status)
 		return
 	}
-	response.WriteAsJson(result)
+	response.WriteHeaderAndEntity(result.Status, result.Entity)
+}
+
+// FindFilter adds a request function to handle GET request.
+func (g *GenericAPIView) FindFilter(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.list(cxt, request.QueryParameter("filter"))
+	})
+}
+
+// FindByID adds a request function to handle GET request with id.
+func (g *GenericAPIView) FindByID(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, g.read)
+}
+
+// SaveOne adds a request function to handle POST request.
+func (g *GenericAPIView) SaveOne(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.save(cxt, request.ReadEntity, "save data")
+	})
+}
+
+// DeleteOne adds a request function to handle DELETE request.
+func (g *GenericAPIView) DeleteOne(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.remove(cxt, request.ReadEntity)
+	})
+}
+
+// ReplaceOne adds a request function to handle PUT request, data are upserted with query parameter onConflict.
+func (g *GenericAPIView) ReplaceOne(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		if conflict := splitColumns(request.QueryParameter("onConflict")); len(conflict) > 0 {
+			return g.upsert(cxt, request.ReadEntity, conflict, splitColumns(request.QueryParameter("update")))
+		}
+		return g.save(cxt, request.ReadEntity, "replace data")
+	})
 }
 
 // UpdateOne adds a request function to handle PATCH request.
 func (g *GenericAPIView) UpdateOne(request *restful.Request, response *restful.Response) {
-	//http.Error(g.cxt.Response, "Method Not Allowed", 405)
-	//result := g.NewStruct
-	result := reflect.New(Indirect(reflect.ValueOf(g.Value)).Type()).Interface()
-	err := request.ReadEntity(result)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "update data", err.Error()))
-		return
-	}
-	err = g.Save(result, g.cxt)
-	if err != nil {
-		response.WriteHeaderAndEntity(http.StatusInternalServerError, NewErrorMsg(http.StatusInternalServerError, "update data", err.Error()))
-		return
-	}
-	response.WriteAsJson(result)
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.save(cxt, request.ReadEntity, "update data")
+	})
 }
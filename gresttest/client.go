@@ -0,0 +1,196 @@
+package gresttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+)
+
+// Request is fluent request builder of the harness
+type Request struct {
+	h      *Harness
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   io.Reader
+}
+
+// GET is create GET request
+func (h *Harness) GET(path string) *Request {
+	return h.NewRequest(http.MethodGet, path)
+}
+
+// POST is create POST request
+func (h *Harness) POST(path string) *Request {
+	return h.NewRequest(http.MethodPost, path)
+}
+
+// PUT is create PUT request
+func (h *Harness) PUT(path string) *Request {
+	return h.NewRequest(http.MethodPut, path)
+}
+
+// PATCH is create PATCH request
+func (h *Harness) PATCH(path string) *Request {
+	return h.NewRequest(http.MethodPatch, path)
+}
+
+// DELETE is create DELETE request
+func (h *Harness) DELETE(path string) *Request {
+	return h.NewRequest(http.MethodDelete, path)
+}
+
+// NewRequest is create request, path is relative to the harness server
+func (h *Harness) NewRequest(method, path string) *Request {
+	return &Request{h: h, method: method, path: path, query: url.Values{}, header: http.Header{}}
+}
+
+// Query add query parameter
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Filter set filter query parameter
+func (r *Request) Filter(filter *grest.Filter) *Request {
+	b, err := json.Marshal(filter)
+	if err != nil {
+		r.h.T.Fatalf("encode filter: %v", err)
+	}
+	r.query.Set("filter", string(b))
+	return r
+}
+
+// Header set request header
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// JSON set JSON body
+func (r *Request) JSON(body interface{}) *Request {
+	b, err := json.Marshal(body)
+	if err != nil {
+		r.h.T.Fatalf("encode body: %v", err)
+	}
+	r.body = bytes.NewReader(b)
+	r.header.Set(restful.HEADER_ContentType, restful.MIME_JSON)
+	return r
+}
+
+// Form set url-encoded form body
+func (r *Request) Form(form url.Values) *Request {
+	r.body = strings.NewReader(form.Encode())
+	r.header.Set(restful.HEADER_ContentType, grest.MIMEForm)
+	return r
+}
+
+// Body set raw body with content type
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.body = bytes.NewReader(body)
+	r.header.Set(restful.HEADER_ContentType, contentType)
+	return r
+}
+
+// Expect send the request and return response for assertions
+func (r *Request) Expect() *Response {
+	r.h.T.Helper()
+	u := r.h.Server.URL + r.path
+	if len(r.query) > 0 {
+		u += "?" + r.query.Encode()
+	}
+	req, err := http.NewRequest(r.method, u, r.body)
+	if err != nil {
+		r.h.T.Fatalf("create request: %v", err)
+	}
+	req.Header = r.header
+	resp, err := r.h.Server.Client().Do(req)
+	if err != nil {
+		r.h.T.Fatalf("%s %s: %v", r.method, r.path, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		r.h.T.Fatalf("read response: %v", err)
+	}
+	return &Response{h: r.h, req: r, Raw: resp, body: body}
+}
+
+// Response is response of the harness request
+type Response struct {
+	h    *Harness
+	req  *Request
+	Raw  *http.Response
+	body []byte
+}
+
+// Status assert status code
+func (r *Response) Status(code int) *Response {
+	r.h.T.Helper()
+	if r.Raw.StatusCode != code {
+		r.h.T.Errorf("%s %s: expected status %d, got %d, body: %s", r.req.method, r.req.path, code, r.Raw.StatusCode, r.body)
+	}
+	return r
+}
+
+// Header assert response header
+func (r *Response) Header(key, value string) *Response {
+	r.h.T.Helper()
+	if got := r.Raw.Header.Get(key); got != value {
+		r.h.T.Errorf("%s %s: expected header %s %q, got %q", r.req.method, r.req.path, key, value, got)
+	}
+	return r
+}
+
+// Count assert count header of query
+func (r *Response) Count(count int) *Response {
+	r.h.T.Helper()
+	return r.Header("count", strconv.Itoa(count))
+}
+
+// Contains assert body contains the string
+func (r *Response) Contains(s string) *Response {
+	r.h.T.Helper()
+	if !bytes.Contains(r.body, []byte(s)) {
+		r.h.T.Errorf("%s %s: expected body contains %q, got %s", r.req.method, r.req.path, s, r.body)
+	}
+	return r
+}
+
+// JSON decode body into v
+func (r *Response) JSON(v interface{}) *Response {
+	r.h.T.Helper()
+	if err := json.Unmarshal(r.body, v); err != nil {
+		r.h.T.Errorf("%s %s: decode body: %v, body: %s", r.req.method, r.req.path, err, r.body)
+	}
+	return r
+}
+
+// Error decode ErrorMsg body and assert its status code
+func (r *Response) Error(statusCode int) *Response {
+	r.h.T.Helper()
+	var msg struct {
+		Error struct {
+			StatusCode int `json:"statusCode"`
+		} `json:"error"`
+	}
+	r.JSON(&msg)
+	if msg.Error.StatusCode != statusCode {
+		r.h.T.Errorf("%s %s: expected error status %d, got %s", r.req.method, r.req.path, statusCode, r.body)
+	}
+	return r
+}
+
+// Body return response body
+func (r *Response) Body() []byte {
+	return r.body
+}
@@ -0,0 +1,147 @@
+// Package gresttest is test harness of grest resources,
+// it serves models from an in-memory SQLite database through GenericAPIView
+// and gives a fluent client to assert responses.
+//
+//	h := gresttest.New(t, &User{})
+//	defer h.Close()
+//	h.LoadFixtures("testdata/users.yaml", &[]User{})
+//	h.GET("/user").Filter(&grest.Filter{Limit: 2}).Expect().Status(200).Count(3)
+package gresttest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+	// sqlite dialect of the harness
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/zhgqiang/grest"
+	"gopkg.in/yaml.v2"
+)
+
+// databaseSeq makes every harness use its own in-memory database
+var databaseSeq int64
+
+// Harness is test harness of grest resources
+type Harness struct {
+	T         testing.TB
+	DB        *gorm.DB
+	API       *grest.API
+	Container *restful.Container
+	Server    *httptest.Server
+}
+
+// New is create harness, models are auto migrated and mounted with default ResourceConfig
+func New(t testing.TB, models ...interface{}) *Harness {
+	t.Helper()
+	name := fmt.Sprintf("file:gresttest%d?mode=memory&cache=shared", atomic.AddInt64(&databaseSeq, 1))
+	db, err := gorm.Open("sqlite3", name)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	// the in-memory database lives as long as one connection is open
+	db.DB().SetMaxIdleConns(1)
+
+	h := &Harness{T: t, DB: db, Container: restful.NewContainer()}
+	h.API = grest.NewAPI(h.Container, (&grest.Context{}).SetDB(db))
+	for _, model := range models {
+		h.AddResource(model)
+	}
+	h.Server = httptest.NewServer(h.Container)
+	return h
+}
+
+// AddResource auto migrate the model and mount it with the config
+func (h *Harness) AddResource(model interface{}, configs ...grest.ResourceConfig) *grest.Resource {
+	h.T.Helper()
+	if err := h.DB.AutoMigrate(model).Error; err != nil {
+		h.T.Fatalf("migrate %T: %v", model, err)
+	}
+	res, err := h.API.AddResource(model, configs...)
+	if err != nil {
+		h.T.Fatalf("add resource %T: %v", model, err)
+	}
+	return res
+}
+
+// Context return grest context with the harness db
+func (h *Harness) Context() *grest.Context {
+	return h.API.Context.Clone()
+}
+
+// Close close the server and the database
+func (h *Harness) Close() {
+	h.Server.Close()
+	h.DB.Close()
+}
+
+// LoadFixtures decode JSON or YAML file into values and save every element,
+// values must be a pointer to slice of models, e.g. &[]User{}
+func (h *Harness) LoadFixtures(path string, values interface{}) {
+	h.T.Helper()
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		h.T.Fatalf("read fixtures: %v", err)
+	}
+	if err := DecodeFixtures(b, filepath.Ext(path), values); err != nil {
+		h.T.Fatalf("decode fixtures %s: %v", path, err)
+	}
+
+	rv := reflect.ValueOf(values).Elem()
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		if err := h.DB.Create(item.Interface()).Error; err != nil {
+			h.T.Fatalf("save fixture %d of %s: %v", i, path, err)
+		}
+	}
+}
+
+// DecodeFixtures decode JSON or YAML fixtures into values by json tags,
+// ext is file extension, .yaml and .yml are YAML and others are JSON
+func DecodeFixtures(b []byte, ext string, values interface{}) error {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("fixtures must be decoded into a pointer to slice, got %T", values)
+	}
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		var data interface{}
+		if err := yaml.Unmarshal(b, &data); err != nil {
+			return err
+		}
+		jsonBytes, err := json.Marshal(yamlToJSON(data))
+		if err != nil {
+			return err
+		}
+		b = jsonBytes
+	}
+	return json.Unmarshal(b, values)
+}
+
+// yamlToJSON convert YAML maps with interface keys into JSON maps
+func yamlToJSON(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			m[fmt.Sprint(key)] = yamlToJSON(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range value {
+			value[i] = yamlToJSON(item)
+		}
+	}
+	return v
+}
@@ -0,0 +1,48 @@
+package gresttest_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type User struct {
+	ID   uint   `json:"id" gorm:"primary_key"`
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestHarness(t *testing.T) {
+	h := gresttest.New(t, &User{})
+	defer h.Close()
+	h.LoadFixtures("testdata/users.json", &[]User{})
+
+	var users []User
+	h.GET("/user").Filter(&grest.Filter{Where: []interface{}{"age >= ?", 30}, Order: "age desc"}).
+		Expect().Status(http.StatusOK).Count(2).JSON(&users)
+	if len(users) != 2 || users[0].Name != "carol" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+
+	created := new(User)
+	h.POST("/user").JSON(&User{Name: "dave", Age: 18}).Expect().Status(http.StatusOK).JSON(created)
+	h.GET("/user/" + "4").Expect().Status(http.StatusOK).Contains(`"dave"`)
+	h.POST("/user").Form(url.Values{"name": {"erin"}}).Expect().Status(http.StatusUnsupportedMediaType)
+	h.DELETE("/user").JSON(created).Expect().Status(http.StatusOK).Contains(`"count"`)
+	h.GET("/user/4").Expect().Status(http.StatusNotFound).Error(http.StatusNotFound)
+	h.GET("/user").Query("filter", "bad").Expect().Status(http.StatusBadRequest)
+}
+
+func TestDecodeFixtures(t *testing.T) {
+	var users []User
+	err := gresttest.DecodeFixtures([]byte("- name: a\n  age: 1\n- name: b\n"), ".yaml", &users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Age != 1 || users[1].Name != "b" {
+		t.Fatalf("unexpected users %+v", users)
+	}
+}
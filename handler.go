@@ -0,0 +1,304 @@
+package grest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Action is operation of resource
+type Action string
+
+// Actions of resource
+const (
+	ActionList   Action = "list"
+	ActionRead   Action = "read"
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionDelete Action = "delete"
+)
+
+var (
+	errNotFound         = errors.New("not found")
+	errMethodNotAllowed = errors.New("method not allowed")
+	errNotAcceptable    = errors.New("no acceptable content type")
+	// errUnbalancedCondition and errInvalidCondition reject raw conditions escaping their group
+	errUnbalancedCondition = errors.New("condition has unbalanced parentheses or quotes")
+	errInvalidCondition    = errors.New("condition must not contain ; # -- or /*")
+	// errScopedJoins reject joins reading rows out of tenant and row scopes
+	errScopedJoins = errors.New("joins are not allowed on scoped queries")
+)
+
+// Result is transport neutral handler result, adapters write it into the response
+type Result struct {
+	Status int
+	Header http.Header
+	Entity interface{}
+}
+
+// DecodeFunc decode request entity into v
+type DecodeFunc func(v interface{}) error
+
+// HTTPError is error with http status, handlers respond it with the status
+type HTTPError struct {
+	Status int
+	Err    error
+}
+
+// NewHTTPError is create HTTPError
+func NewHTTPError(status int, err error) *HTTPError {
+	return &HTTPError{Status: status, Err: err}
+}
+
+// Error is error message
+func (e *HTTPError) Error() string {
+	return e.Err.Error()
+}
+
+// isHTTPError is whether err is HTTPError
+func isHTTPError(err error) bool {
+	_, ok := err.(*HTTPError)
+	return ok
+}
+
+// errorResult is create ErrorMsg result, the status of HTTPError has priority
+func errorResult(status int, name string, err error) *Result {
+	if e, ok := err.(*HTTPError); ok {
+		status = e.Status
+	}
+	return &Result{Status: status, Entity: NewErrorMsg(status, name, err.Error())}
+}
+
+// ParseFilter parse JSON-encoded filter, empty string is empty filter
+func ParseFilter(filter string) (*Filter, error) {
+	result := new(Filter)
+	if filter = strings.TrimSpace(filter); filter != "" {
+		if err := json.Unmarshal([]byte(filter), result); err != nil {
+			return nil, NewHTTPError(http.StatusBadRequest, err)
+		}
+	}
+	if err := checkWhere(result.Where); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkWhere check the raw condition of where, it must not escape its group of the query, see checkCondition
+func checkWhere(where []interface{}) error {
+	if len(where) == 0 {
+		return nil
+	}
+	if cond, ok := where[0].(string); ok {
+		return checkCondition(cond)
+	}
+	return nil
+}
+
+// checkCondition reject raw SQL with unbalanced parentheses, statement separators or comments out of string literals,
+// gorm puts the condition in parentheses and AND it with tenant and row scopes
+func checkCondition(cond string) error {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(cond); i++ {
+		c := cond[i]
+		if quote != 0 {
+			if c == quote {
+				if i+1 < len(cond) && cond[i+1] == quote {
+					i++
+				} else {
+					quote = 0
+				}
+			}
+			continue
+		}
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			if depth--; depth < 0 {
+				return NewHTTPError(http.StatusBadRequest, errUnbalancedCondition)
+			}
+		case c == ';' || c == '#' || strings.HasPrefix(cond[i:], "--") || strings.HasPrefix(cond[i:], "/*"):
+			return NewHTTPError(http.StatusBadRequest, errInvalidCondition)
+		}
+	}
+	if depth != 0 || quote != 0 {
+		return NewHTTPError(http.StatusBadRequest, errUnbalancedCondition)
+	}
+	return nil
+}
+
+// checkColumns accept only column names of the model in fields, order and groups, expressions,
+// subqueries and aliases are rejected, joins are rejected if queries of the context are scoped
+func checkColumns(value interface{}, filter *Filter, context *Context) error {
+	if filter == nil {
+		return nil
+	}
+	if len(filter.Joins) > 0 && context.Scoped() {
+		return NewHTTPError(http.StatusBadRequest, errScopedJoins)
+	}
+	columns, _ := modelColumns(value)
+	isColumn := func(name string) error {
+		for _, column := range columns {
+			if name == column {
+				return nil
+			}
+		}
+		return NewHTTPError(http.StatusBadRequest, fmt.Errorf("%q is not a column", name))
+	}
+	for _, field := range filter.Fields {
+		if err := isColumn(field); err != nil {
+			return err
+		}
+	}
+	for _, group := range filter.Groups {
+		if err := isColumn(group); err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(filter.Order) == "" {
+		return nil
+	}
+	for _, order := range strings.Split(filter.Order, ",") {
+		words := strings.Fields(order)
+		if len(words) == 0 || len(words) > 2 {
+			return NewHTTPError(http.StatusBadRequest, fmt.Errorf("%q is not a column", strings.TrimSpace(order)))
+		}
+		if len(words) == 2 && !strings.EqualFold(words[1], "asc") && !strings.EqualFold(words[1], "desc") {
+			return NewHTTPError(http.StatusBadRequest, fmt.Errorf("%q is not asc or desc", words[1]))
+		}
+		if err := isColumn(words[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newOne initialize a struct pointer of the resource
+func (g *GenericAPIView) newOne() interface{} {
+	return g.model.newOne()
+}
+
+// newSlice initialize a slice pointer of the resource
+func (g *GenericAPIView) newSlice() interface{} {
+	return g.model.newSlice()
+}
+
+// list query data by the filter
+func (g *GenericAPIView) list(cxt *Context, rawFilter string) *Result {
+	filter, err := ParseFilter(rawFilter)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "query data", err)
+	}
+	setSpanAttributes(cxt, AttrFilterShape.String(FilterShape(filter)))
+	decision, denied := g.authorize(cxt, ActionList)
+	if denied != nil {
+		return denied
+	}
+	if err := checkMask(g.Value, filter, decision.Mask); err != nil {
+		return errorResult(http.StatusForbidden, "query data", err)
+	}
+	results := g.newSlice()
+	var count int
+	if filter.AsOf != nil {
+		if g.History == nil {
+			return errorResult(http.StatusBadRequest, "query data", errAsOf)
+		}
+		count, err = g.History.FindAsOf(results, filter, cxt)
+	} else {
+		count, err = g.FindMany(results, filter, cxt)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "query data", err)
+	}
+	maskFields(results, decision.Mask)
+	header := http.Header{}
+	header.Set("count", strconv.Itoa(count))
+	if filter.AsOf == nil {
+		g.cacheControl(header, cxt)
+	}
+	return &Result{Status: http.StatusOK, Header: header, Entity: results}
+}
+
+// read query data by the resource id of context
+func (g *GenericAPIView) read(cxt *Context) *Result {
+	decision, denied := g.authorize(cxt, ActionRead)
+	if denied != nil {
+		return denied
+	}
+	result := g.newOne()
+	err := g.FindOne(result, cxt)
+	if err == gorm.ErrRecordNotFound {
+		return errorResult(http.StatusNotFound, "query data", err)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "query data", err)
+	}
+	maskFields(result, decision.Mask)
+	header := http.Header{}
+	g.cacheControl(header, cxt)
+	return &Result{Status: http.StatusOK, Header: header, Entity: result}
+}
+
+// cacheControl set Cache-Control header if the view tells it, see CachedView
+func (g *GenericAPIView) cacheControl(header http.Header, cxt *Context) {
+	if c, ok := g.view().(CacheControl); ok {
+		if value := c.CacheControl(cxt); value != "" {
+			header.Set("Cache-Control", value)
+		}
+	}
+}
+
+// save decode and save data, name is used in error messages
+func (g *GenericAPIView) save(cxt *Context, decode DecodeFunc, name string) *Result {
+	result := g.newOne()
+	if err := decode(result); err != nil {
+		return errorResult(http.StatusInternalServerError, name, err)
+	}
+	action := ActionUpdate
+	if scope := (&gorm.Scope{Value: result}); scope.PrimaryKeyZero() {
+		action = ActionCreate
+	}
+	decision, denied := g.authorize(cxt, action)
+	if denied != nil {
+		return denied
+	}
+	if err := g.guardWrite(cxt, result, action, decision); err != nil {
+		return errorResult(http.StatusInternalServerError, name, err)
+	}
+	err := g.Save(result, cxt)
+	if err == gorm.ErrRecordNotFound {
+		return errorResult(http.StatusNotFound, name, err)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, name, err)
+	}
+	maskFields(result, decision.Mask)
+	return &Result{Status: http.StatusOK, Entity: result}
+}
+
+// remove decode and delete data
+func (g *GenericAPIView) remove(cxt *Context, decode DecodeFunc) *Result {
+	if _, denied := g.authorize(cxt, ActionDelete); denied != nil {
+		return denied
+	}
+	result := g.newOne()
+	if err := decode(result); err != nil {
+		return errorResult(http.StatusInternalServerError, "delete data", err)
+	}
+	err := g.Delete(result, cxt)
+	if err == gorm.ErrRecordNotFound {
+		return errorResult(http.StatusNotFound, "delete data", err)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "delete data", err)
+	}
+	return &Result{Status: http.StatusOK, Entity: NewDeleteMsg(1)}
+}
@@ -0,0 +1,334 @@
+package grest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/jinzhu/gorm"
+)
+
+// HistorySuffix is suffix of history table name, e.g. user_versions
+var HistorySuffix = "_versions"
+
+var errAsOf = errors.New("asOf is not supported by the resource")
+
+// Version is snapshot of a record after a write
+type Version struct {
+	ID         uint            `json:"id" gorm:"primary_key"`
+	ResourceID string          `json:"resourceId" gorm:"index"`
+	Version    int             `json:"version"`
+	TenantID   string          `json:"tenantId,omitempty" gorm:"index"`
+	Action     string          `json:"action"`
+	Actor      string          `json:"actor"`
+	Deleted    bool            `json:"deleted"`
+	Data       json.RawMessage `json:"data" gorm:"type:text"`
+	CreatedAt  time.Time       `json:"createdAt" gorm:"index"`
+}
+
+// History keep versions of models in their history tables
+//
+//	history := grest.NewHistory()
+//	history.Migrate(db, &User{})
+//	api.AddResource(&User{}, grest.ResourceConfig{History: history})
+type History struct {
+	// Actor of the version, default is id of Principal
+	Actor func(cxt *Context) string
+}
+
+// NewHistory is create History
+func NewHistory() *History {
+	return new(History)
+}
+
+// Table is history table name of the model
+func (h *History) Table(db *gorm.DB, value interface{}) string {
+	return db.NewScope(value).TableName() + HistorySuffix
+}
+
+// Migrate create history tables of the models, (resource_id, version) is unique
+// so concurrent writes of a record can not insert the same version
+func (h *History) Migrate(db *gorm.DB, values ...interface{}) error {
+	for _, value := range values {
+		table := h.Table(db, value)
+		if err := db.Table(table).AutoMigrate(&Version{}).Error; err != nil {
+			return err
+		}
+		if err := db.Table(table).AddUniqueIndex("uix_"+table+"_version", "resource_id", "version").Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Hook is WriteHook inserting version of the change
+func (h *History) Hook() WriteHook {
+	return func(tx *gorm.DB, change *Change) error {
+		data := change.After
+		if change.Action == ActionDelete {
+			data = change.Before
+		}
+		if data == nil {
+			return nil
+		}
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		table := h.Table(tx, data)
+		last := new(Version)
+		err = tx.Table(table).Where("resource_id = ?", change.ID).Order("version desc").First(last).Error
+		if err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		version := &Version{
+			ResourceID: change.ID,
+			Version:    last.Version + 1,
+			Action:     string(change.Action),
+			Deleted:    change.Action == ActionDelete,
+			Data:       b,
+		}
+		if field, ok := tenantField(tx.NewScope(data)); ok && !field.IsBlank {
+			version.TenantID = fmt.Sprint(field.Field.Interface())
+		}
+		if cxt := change.Context; cxt != nil {
+			if h.Actor != nil {
+				version.Actor = h.Actor(cxt)
+			} else if cxt.Principal != nil {
+				version.Actor = cxt.Principal.ID
+			}
+		}
+		return tx.Table(table).Create(version).Error
+	}
+}
+
+// Versions query versions of the record in order
+func (h *History) Versions(db *gorm.DB, value interface{}, id string) ([]Version, error) {
+	versions := make([]Version, 0)
+	err := db.Table(h.Table(db, value)).Where("resource_id = ?", id).Order("version").Find(&versions).Error
+	return versions, err
+}
+
+// Version query version n of the record
+func (h *History) Version(db *gorm.DB, value interface{}, id string, n int) (*Version, error) {
+	version := new(Version)
+	err := db.Table(h.Table(db, value)).Where("resource_id = ? AND version = ?", id, n).First(version).Error
+	if err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// FindAsOf query data as of the time of the filter, the state is reconstructed from the latest versions
+// before the time, tenant is queried by SQL, row scopes and where are evaluated on the snapshots,
+// order, offset and limit are evaluated in memory, see MemoryView
+func (h *History) FindAsOf(result interface{}, filter *Filter, context *Context) (int, error) {
+	db := context.GetDB()
+	if db == nil {
+		return 0, errors.New("db is nil")
+	}
+	if filter == nil || filter.AsOf == nil {
+		return 0, errors.New("asOf is required")
+	}
+	matcher, err := NewMatcher(filter.Where)
+	if err != nil {
+		return 0, err
+	}
+
+	modelType := ModelType(result)
+	table := h.Table(db, result)
+	latest := db.Table(table+" latest").Select("MAX(latest.version)").
+		Where("latest.resource_id = v.resource_id AND latest.created_at <= ?", *filter.AsOf).SubQuery()
+	query := db.Table(table+" v").Where("v.version = ? AND v.deleted = ?", latest, false)
+	if _, ok := tenantField(db.NewScope(reflect.New(modelType).Interface())); ok && context.TenantScoped() {
+		query = query.Where("v.tenant_id = ?", context.TenantID)
+	}
+	rows, err := query.Order("v.resource_id").Rows()
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	records := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(modelType)), 0, 0)
+	for rows.Next() {
+		version := new(Version)
+		if err := db.ScanRows(rows, version); err != nil {
+			return 0, err
+		}
+		record := reflect.New(modelType)
+		if err := json.Unmarshal(version.Data, record.Interface()); err != nil {
+			return 0, err
+		}
+		ok, err := matchScopes(record.Interface(), context)
+		if err != nil {
+			return 0, err
+		}
+		if ok && matcher.Match(record.Interface()) {
+			records = reflect.Append(records, record)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	view := NewMemoryView()
+	if err := view.Load(records.Interface()); err != nil {
+		return 0, err
+	}
+	current := *filter
+	current.AsOf = nil
+	current.Where = nil
+	return view.FindMany(result, &current, context)
+}
+
+// versionRoutes register history routes of the resource with the route function of WebService
+func (g *GenericAPIView) versionRoutes(route func(Action, *restful.RouteBuilder), tags []string) {
+	idParam := g.WS.PathParameter("id", "primary key, multiple primary values are joined with a comma").DataType("string")
+	nParam := g.WS.PathParameter("n", "version number").DataType("integer")
+	route(ActionRead, returnsErrors(g.WS.GET("/{id}/versions").To(g.FindVersions).
+		Param(idParam).Doc("query versions").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "query success", []Version{}), http.StatusInternalServerError))
+
+	route(ActionRead, returnsErrors(g.WS.GET("/{id}/versions/{n}").To(g.FindVersion).
+		Param(idParam).Param(nParam).Doc("query version").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "query success", Version{}), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError))
+
+	// revert has no body
+	route(ActionUpdate, returnsErrors(g.WS.POST("/{id}/revert/{n}").To(g.RevertVersion).
+		AllowedMethodsWithoutContentType([]string{http.MethodPost}).
+		Param(idParam).Param(nParam).Doc("revert to version").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "revert success", g.NewStruct), http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError))
+}
+
+// FindVersions adds a request function to handle GET request of versions.
+func (g *GenericAPIView) FindVersions(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, g.versions)
+}
+
+// FindVersion adds a request function to handle GET request of a version.
+func (g *GenericAPIView) FindVersion(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.version(cxt, request.PathParameter("n"))
+	})
+}
+
+// RevertVersion adds a request function to handle POST request of reverting.
+func (g *GenericAPIView) RevertVersion(request *restful.Request, response *restful.Response) {
+	g.handle(request, response, func(cxt *Context) *Result {
+		return g.revert(cxt, request.PathParameter("n"))
+	})
+}
+
+// versions query versions visible to the context
+func (g *GenericAPIView) versions(cxt *Context) *Result {
+	decision, denied := g.authorize(cxt, ActionRead)
+	if denied != nil {
+		return denied
+	}
+	versions, err := g.History.Versions(cxt.GetDB(), g.Value, cxt.ResourceID)
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "query versions", err)
+	}
+	visible := make([]Version, 0, len(versions))
+	for _, version := range versions {
+		ok, err := g.visibleVersion(&version, cxt, decision)
+		if err != nil {
+			return errorResult(http.StatusInternalServerError, "query versions", err)
+		}
+		if ok {
+			visible = append(visible, version)
+		}
+	}
+	return &Result{Status: http.StatusOK, Entity: visible}
+}
+
+// version query version n visible to the context
+func (g *GenericAPIView) version(cxt *Context, n string) *Result {
+	decision, denied := g.authorize(cxt, ActionRead)
+	if denied != nil {
+		return denied
+	}
+	version, result := g.findVersion(cxt, n, decision)
+	if result != nil {
+		return result
+	}
+	return &Result{Status: http.StatusOK, Entity: version}
+}
+
+// revert save data of version n over the stored row, fields out of the snapshot and masked fields are kept
+func (g *GenericAPIView) revert(cxt *Context, n string) *Result {
+	decision, denied := g.authorize(cxt, ActionUpdate)
+	if denied != nil {
+		return denied
+	}
+	version, result := g.findVersion(cxt, n, decision)
+	if result != nil {
+		return result
+	}
+	return g.save(cxt, func(v interface{}) error {
+		// the deleted row is created again
+		if err := g.findStored(v, cxt, cxt.ResourceID); err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		}
+		stored := &gorm.Scope{Value: copyValue(v)}
+		if err := json.Unmarshal(version.Data, v); err != nil {
+			return err
+		}
+		scope := &gorm.Scope{Value: v}
+		for _, name := range decision.Mask {
+			if field, ok := lookupField(scope, name); ok {
+				storedField, _ := lookupField(stored, name)
+				field.Field.Set(storedField.Field)
+			}
+		}
+		return nil
+	}, "revert data")
+}
+
+// findVersion parse n and query the version, the result is not nil on failure
+func (g *GenericAPIView) findVersion(cxt *Context, n string, decision *Decision) (*Version, *Result) {
+	number, err := strconv.Atoi(n)
+	if err != nil {
+		return nil, errorResult(http.StatusBadRequest, "query version", err)
+	}
+	version, err := g.History.Version(cxt.GetDB(), g.Value, cxt.ResourceID, number)
+	if err == gorm.ErrRecordNotFound {
+		return nil, errorResult(http.StatusNotFound, "query version", err)
+	}
+	if err != nil {
+		return nil, errorResult(http.StatusInternalServerError, "query version", err)
+	}
+	ok, err := g.visibleVersion(version, cxt, decision)
+	if err != nil {
+		return nil, errorResult(http.StatusInternalServerError, "query version", err)
+	}
+	if !ok {
+		return nil, errorResult(http.StatusNotFound, "query version", gorm.ErrRecordNotFound)
+	}
+	return version, nil
+}
+
+// visibleVersion check the data of version against tenant and row scopes, masked fields are removed
+func (g *GenericAPIView) visibleVersion(version *Version, cxt *Context, decision *Decision) (bool, error) {
+	record := g.newOne()
+	if err := json.Unmarshal(version.Data, record); err != nil {
+		return false, err
+	}
+	ok, err := matchScopes(record, cxt)
+	if err != nil || !ok {
+		return false, err
+	}
+	if len(decision.Mask) > 0 {
+		maskFields(record, decision.Mask)
+		if version.Data, err = json.Marshal(record); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,120 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestHistory(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	history := grest.NewHistory()
+	if err := history.Migrate(h.DB, &Doc{}); err != nil {
+		t.Fatal(err)
+	}
+	h.AddResource(&Doc{}, grest.ResourceConfig{History: history})
+
+	doc := new(Doc)
+	h.POST("/doc").JSON(&Doc{Title: "v1"}).Expect().Status(http.StatusOK).JSON(doc)
+	h.POST("/doc").JSON(&Doc{Title: "other"}).Expect().Status(http.StatusOK)
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	doc.Title = "v2"
+	h.PUT("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	h.DELETE("/doc").JSON(doc).Expect().Status(http.StatusOK)
+
+	var versions []grest.Version
+	h.GET("/doc/1/versions").Expect().Status(http.StatusOK).JSON(&versions)
+	if len(versions) != 3 || versions[1].Version != 2 || !versions[2].Deleted {
+		t.Fatalf("unexpected versions %+v", versions)
+	}
+	h.GET("/doc/1/versions/2").Expect().Status(http.StatusOK).Contains(`"v2"`)
+	h.GET("/doc/1/versions/9").Expect().Status(http.StatusNotFound)
+	h.GET("/doc/1/versions/x").Expect().Status(http.StatusBadRequest)
+
+	var docs []Doc
+	h.GET("/doc").Filter(&grest.Filter{AsOf: &asOf, Where: []interface{}{"title = ?", "v1"}}).Expect().Status(http.StatusOK).Count(1).JSON(&docs)
+	if len(docs) != 1 || docs[0].ID != 1 {
+		t.Fatalf("unexpected docs as of %v: %+v", asOf, docs)
+	}
+	h.GET("/doc").Expect().Status(http.StatusOK).Count(1)
+
+	h.POST("/doc/1/revert/1").Expect().Status(http.StatusOK).Contains(`"v1"`)
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Contains(`"v1"`)
+	h.GET("/doc/1/versions").Expect().Status(http.StatusOK).JSON(&versions)
+	if len(versions) != 4 {
+		t.Fatalf("unexpected versions after revert %+v", versions)
+	}
+
+	h.GET("/note").Expect().Status(http.StatusNotFound)
+	users := gresttest.New(t, &User{})
+	defer users.Close()
+	users.GET("/user").Filter(&grest.Filter{AsOf: &asOf}).Expect().Status(http.StatusBadRequest)
+}
+
+func TestHistory_Revert(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	history := grest.NewHistory()
+	if err := history.Migrate(h.DB, &Article{}); err != nil {
+		t.Fatal(err)
+	}
+	principal := func(cxt *grest.Context) error {
+		cxt.Principal = &grest.Principal{ID: "u", Roles: []string{cxt.Request.HeaderParameter("X-Role")}}
+		return nil
+	}
+	policy := grest.RolePolicy{
+		"reader": {{Resource: "Article", Actions: []grest.Action{grest.ActionList, grest.ActionRead}}},
+		"writer": {{Resource: "Article"}},
+	}
+	h.AddResource(&Article{}, grest.ResourceConfig{History: history, Hooks: []grest.ContextHook{principal}, Policy: policy})
+
+	article := new(Article)
+	h.POST("/article").Header("X-Role", "writer").JSON(&Article{Title: "v1"}).Expect().Status(http.StatusOK).JSON(article)
+	article.Title = "v2"
+	h.PUT("/article").Header("X-Role", "writer").JSON(article).Expect().Status(http.StatusOK)
+	h.DB.Model(article).Update("hidden", "h")
+
+	// revert is authorized as update before the version is read
+	h.POST("/article/1/revert/1").Header("X-Role", "reader").Expect().Status(http.StatusForbidden)
+	h.POST("/article/1/revert/9").Header("X-Role", "reader").Expect().Status(http.StatusForbidden)
+	h.POST("/article/1/revert/1").Header("X-Role", "writer").Expect().Status(http.StatusOK).Contains(`"v1"`)
+
+	// the field out of the snapshot is kept
+	stored := new(Article)
+	h.DB.First(stored)
+	if stored.Title != "v1" || stored.Hidden != "h" {
+		t.Fatalf("unexpected article %+v", stored)
+	}
+}
+
+func TestHistory_Tenant(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	history := grest.NewHistory()
+	if err := history.Migrate(h.DB, &Note{}); err != nil {
+		t.Fatal(err)
+	}
+	tenancy := &grest.Tenancy{Resolver: grest.HeaderTenant("X-Tenant-ID")}
+	h.AddResource(&Note{}, grest.ResourceConfig{History: history, Hooks: []grest.ContextHook{tenancy.Hook()}})
+
+	h.POST("/note").Header("X-Tenant-ID", "a").JSON(&Note{Title: "a1"}).Expect().Status(http.StatusOK)
+	h.POST("/note").Header("X-Tenant-ID", "b").JSON(&Note{Title: "b1"}).Expect().Status(http.StatusOK)
+	asOf := time.Now().Add(time.Second)
+	var notes []Note
+	h.GET("/note").Header("X-Tenant-ID", "b").Filter(&grest.Filter{AsOf: &asOf}).Expect().Status(http.StatusOK).Count(1).JSON(&notes)
+	if len(notes) != 1 || notes[0].Title != "b1" {
+		t.Fatalf("unexpected notes of tenant b as of %v: %+v", asOf, notes)
+	}
+
+	// the version of a record is unique
+	duplicate := &grest.Version{ResourceID: "1", Version: 1, TenantID: "a"}
+	if err := h.DB.Table(history.Table(h.DB, &Note{})).Create(duplicate).Error; err == nil {
+		t.Fatal("expected error of duplicate version")
+	}
+}
@@ -0,0 +1,186 @@
+package grest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emicklei/go-restful"
+)
+
+// HTTPHandler is net/http adapter of GenericAPIView, it can be mounted on any router
+// the paths are relative to the mount point, e.g. with net/http
+//
+//	http.Handle("/user/", http.StripPrefix("/user", g.HTTPHandler()))
+//
+// or with chi
+//
+//	r.Mount("/user", g.HTTPHandler())
+//
+// the db put into request context with ContextDBName is used if exists,
+// request bodies are read and results are written by the codecs of Consumes and Produces, see RegisterCodec
+func (g *GenericAPIView) HTTPHandler() http.Handler {
+	return http.HandlerFunc(g.ServeHTTP)
+}
+
+// ServeHTTP dispatch the request to the transport neutral handlers
+func (g *GenericAPIView) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	produces := g.Produces
+	if len(produces) == 0 {
+		produces = []string{restful.MIME_JSON}
+	}
+	mime := negotiate(r.Header.Get(restful.HEADER_Accept), produces)
+	if mime == "" {
+		writeHTTPResult(w, produces[0], errorResult(http.StatusNotAcceptable, "not acceptable", errNotAcceptable))
+		return
+	}
+	if !g.allowMethod(r.Method) {
+		writeHTTPResult(w, mime, errorResult(http.StatusMethodNotAllowed, "method not allowed", errMethodNotAllowed))
+		return
+	}
+
+	request := restful.NewRequest(r)
+	cxt, err := g.newContext(request, restful.NewResponse(w))
+	if err != nil {
+		writeHTTPResult(w, mime, errorResult(http.StatusBadRequest, "request context", err))
+		return
+	}
+	// registered codecs are used, JSON is assumed without content type
+	decode := func(v interface{}) error {
+		if r.Header.Get(restful.HEADER_ContentType) == "" {
+			return json.NewDecoder(r.Body).Decode(v)
+		}
+		return request.ReadEntity(v)
+	}
+
+	path := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	id := path[0]
+	result := g.traceHandler(cxt, httpAction(r.Method, id), func(cxt *Context) *Result {
+		switch {
+		case len(path) > 1:
+			cxt.ResourceID = id
+			return g.serveVersions(cxt, r.Method, path[1:])
+		case id == "stream" && r.Method == http.MethodGet && g.Stream != nil:
+			return g.stream(cxt, w, r)
+		case id == "_schema" && r.Method == http.MethodGet:
+			return &Result{Status: http.StatusOK, Entity: g.Schema()}
+		case id != "" && r.Method == http.MethodGet:
+			cxt.ResourceID = id
+			return g.read(cxt)
+		case id != "":
+			return errorResult(http.StatusNotFound, "not found", errNotFound)
+		case r.Method == http.MethodGet:
+			return g.list(cxt, r.URL.Query().Get("filter"))
+		case r.Method == http.MethodPost:
+			return g.save(cxt, decode, "save data")
+		case r.Method == http.MethodPut && r.URL.Query().Get("onConflict") != "":
+			query := r.URL.Query()
+			return g.upsert(cxt, decode, splitColumns(query.Get("onConflict")), splitColumns(query.Get("update")))
+		case r.Method == http.MethodPut:
+			return g.save(cxt, decode, "replace data")
+		case r.Method == http.MethodPatch:
+			return g.save(cxt, decode, "update data")
+		case r.Method == http.MethodDelete:
+			return g.remove(cxt, decode)
+		default:
+			return errorResult(http.StatusMethodNotAllowed, "method not allowed", errMethodNotAllowed)
+		}
+	})
+	if result == nil {
+		// the response is written, e.g. by Stream
+		return
+	}
+	writeHTTPResult(w, mime, result)
+}
+
+// httpAction is action of the method, the request with id reads one
+func httpAction(method string, id string) Action {
+	switch method {
+	case http.MethodGet:
+		if id != "" {
+			return ActionRead
+		}
+		return ActionList
+	case http.MethodPost:
+		return ActionCreate
+	case http.MethodDelete:
+		return ActionDelete
+	default:
+		return ActionUpdate
+	}
+}
+
+// writeHTTPResult write handler result with the codec of mime
+func writeHTTPResult(w http.ResponseWriter, mime string, result *Result) {
+	for key, values := range result.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if result.Entity == nil {
+		w.WriteHeader(result.Status)
+		return
+	}
+	response := restful.NewResponse(w)
+	response.SetRequestAccepts(mime)
+	response.WriteHeaderAndEntity(result.Status, result.Entity)
+}
+
+// negotiate select the first of produces accepted by the Accept header in order of quality,
+// the first of produces is selected without Accept header, "" is not acceptable
+func negotiate(accept string, produces []string) string {
+	if strings.TrimSpace(accept) == "" {
+		return produces[0]
+	}
+	type mediaRange struct {
+		media   string
+		quality float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		accepted := mediaRange{media: strings.ToLower(strings.TrimSpace(params[0])), quality: 1}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					accepted.quality = q
+				}
+			}
+		}
+		if accepted.media != "" && accepted.quality > 0 {
+			ranges = append(ranges, accepted)
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+	for _, accepted := range ranges {
+		for _, produce := range produces {
+			switch {
+			case accepted.media == "*/*", accepted.media == produce:
+				return produce
+			case strings.HasSuffix(accepted.media, "/*") && strings.HasPrefix(produce, accepted.media[:len(accepted.media)-1]):
+				return produce
+			}
+		}
+	}
+	return ""
+}
+
+// serveVersions dispatch history routes, path is relative to the resource id
+func (g *GenericAPIView) serveVersions(cxt *Context, method string, path []string) *Result {
+	switch {
+	case g.History == nil:
+		return errorResult(http.StatusNotFound, "not found", errNotFound)
+	case len(path) == 1 && path[0] == "versions" && method == http.MethodGet:
+		return g.versions(cxt)
+	case len(path) == 2 && path[0] == "versions" && method == http.MethodGet:
+		return g.version(cxt, path[1])
+	case len(path) == 2 && path[0] == "revert" && method == http.MethodPost:
+		return g.revert(cxt, path[1])
+	}
+	return errorResult(http.StatusNotFound, "not found", errNotFound)
+}
@@ -0,0 +1,49 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	res := h.AddResource(&Doc{}, grest.ResourceConfig{Produces: []string{restful.MIME_JSON, restful.MIME_XML}})
+	h.Container.Handle("/raw/", http.StripPrefix("/raw", res.View.HTTPHandler()))
+
+	doc := new(Doc)
+	h.POST("/raw/").Body("", []byte(`{"title":"t1"}`)).Expect().Status(http.StatusOK).
+		Header(restful.HEADER_ContentType, restful.MIME_JSON).JSON(doc)
+	if doc.ID == 0 || doc.Title != "t1" {
+		t.Fatalf("unexpected doc %+v", doc)
+	}
+	h.GET("/raw/").Expect().Status(http.StatusOK).Count(1).Contains(`"t1"`)
+	h.GET("/raw/1").Expect().Status(http.StatusOK).Contains(`"t1"`)
+	h.GET("/raw/9").Expect().Status(http.StatusNotFound).Error(http.StatusNotFound)
+	h.GET("/raw/1/versions").Expect().Status(http.StatusNotFound)
+
+	// the result is written by the codec accepted by the request
+	h.GET("/raw/1").Header("Accept", restful.MIME_XML).Expect().Status(http.StatusOK).
+		Header(restful.HEADER_ContentType, restful.MIME_XML).Contains("<Title>t1</Title>")
+	h.GET("/raw/1").Header("Accept", "application/xml;q=0.5, application/json").Expect().Status(http.StatusOK).
+		Header(restful.HEADER_ContentType, restful.MIME_JSON)
+	h.GET("/raw/1").Header("Accept", "text/html, */*;q=0.1").Expect().Status(http.StatusOK).
+		Header(restful.HEADER_ContentType, restful.MIME_JSON)
+	h.GET("/raw/9").Header("Accept", restful.MIME_XML).Expect().Status(http.StatusNotFound).
+		Header(restful.HEADER_ContentType, restful.MIME_XML)
+	h.GET("/raw/1").Header("Accept", "text/html").Expect().Status(http.StatusNotAcceptable)
+
+	// the body is read by the codec of its content type
+	h.PUT("/raw/").Body(restful.MIME_XML, []byte(`<Doc><ID>1</ID><Title>t2</Title></Doc>`)).Expect().Status(http.StatusOK)
+	h.GET("/raw/1").Expect().Status(http.StatusOK).Contains(`"t2"`)
+	h.DELETE("/raw/").JSON(&Doc{ID: 1}).Expect().Status(http.StatusOK)
+	h.GET("/raw/").Expect().Status(http.StatusOK).Count(0)
+
+	readOnly := h.AddResource(&Note{}, grest.ResourceConfig{ReadOnly: true})
+	h.Container.Handle("/notes/", http.StripPrefix("/notes", readOnly.View.HTTPHandler()))
+	h.POST("/notes/").JSON(&Note{Title: "n"}).Expect().Status(http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,242 @@
+package grest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+)
+
+// Headers of idempotent requests
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on replayed responses
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+)
+
+// IdempotencyTable is table name of IdempotencyRecord
+var IdempotencyTable = "idempotency_key"
+
+var (
+	errIdempotencyInProgress = errors.New("request with the idempotency key is in progress")
+	errIdempotencyMismatch   = errors.New("idempotency key is reused with a different payload")
+)
+
+// IdempotencyRecord is the first response of an idempotency key of a principal
+type IdempotencyRecord struct {
+	// ID is hash of the principal and the key
+	ID          string    `json:"id" gorm:"primary_key"`
+	Key         string    `json:"key" gorm:"column:idempotency_key"`
+	Principal   string    `json:"principal"`
+	RequestHash string    `json:"requestHash"`
+	Completed   bool      `json:"completed"`
+	Status      int       `json:"status"`
+	Header      string    `json:"header" gorm:"type:text"`
+	Body        []byte    `json:"body"`
+	ExpiresAt   time.Time `json:"expiresAt" gorm:"index"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+// TableName is IdempotencyTable
+func (IdempotencyRecord) TableName() string {
+	return IdempotencyTable
+}
+
+// Idempotency replay the first response of requests with Idempotency-Key, the key is scoped by principal,
+// a request while the first one is in progress gets 409, the key reused with a different payload gets 422.
+// Requests without principal share one scope of keys, use it after authentication or set Principal,
+// e.g. to the client ip, if anonymous requests are allowed
+//
+//	idempotency := grest.NewIdempotency(db, 24*time.Hour)
+//	idempotency.Migrate()
+//	api.AddResource(&User{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{auth.Filter, idempotency.Filter}})
+type Idempotency struct {
+	DB  *gorm.DB
+	TTL time.Duration
+	// Methods are idempotent http methods by the key, default is POST
+	Methods []string
+	// Principal is scope of keys, default is tenant and id of Principal
+	Principal func(request *restful.Request) string
+	// LockTimeout is max duration of the first request, the key is taken again after it if the request is not completed,
+	// e.g. the process crashed, default is 1 minute
+	LockTimeout time.Duration
+}
+
+// NewIdempotency is create Idempotency keeping responses in db for ttl
+func NewIdempotency(db *gorm.DB, ttl time.Duration) *Idempotency {
+	return &Idempotency{DB: db, TTL: ttl, Methods: []string{http.MethodPost}, LockTimeout: time.Minute}
+}
+
+// Migrate create the idempotency table
+func (i *Idempotency) Migrate() error {
+	return i.DB.AutoMigrate(&IdempotencyRecord{}).Error
+}
+
+// Purge delete expired records
+func (i *Idempotency) Purge() error {
+	return i.DB.Where("expires_at < ?", time.Now()).Delete(&IdempotencyRecord{}).Error
+}
+
+// Filter is restful filter of idempotent requests, use it as resource Middleware after authentication
+func (i *Idempotency) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	key := request.HeaderParameter(HeaderIdempotencyKey)
+	if key == "" || !containsString(i.Methods, request.Request.Method) {
+		chain.ProcessFilter(request, response)
+		return
+	}
+	body, err := io.ReadAll(request.Request.Body)
+	if err != nil {
+		writeResult(response, errorResult(http.StatusBadRequest, "idempotency", err))
+		return
+	}
+	request.Request.Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(append([]byte(request.Request.Method+" "+request.Request.URL.RequestURI()+"\n"), body...))
+	record := &IdempotencyRecord{
+		Key:         key,
+		Principal:   i.principal(request),
+		RequestHash: hex.EncodeToString(sum[:]),
+		ExpiresAt:   time.Now().Add(i.TTL),
+	}
+	id := sha256.Sum256([]byte(record.Principal + "\n" + key))
+	record.ID = hex.EncodeToString(id[:])
+	existing, err := i.acquire(record)
+	if err == errIdempotencyInProgress {
+		writeResult(response, errorResult(http.StatusConflict, "idempotency", err))
+		return
+	}
+	if err != nil {
+		writeResult(response, errorResult(http.StatusInternalServerError, "idempotency", err))
+		return
+	}
+	if existing != nil {
+		i.replay(response, record, existing)
+		return
+	}
+
+	recorder := &responseRecorder{ResponseWriter: response.ResponseWriter, status: http.StatusOK}
+	response.ResponseWriter = recorder
+	chain.ProcessFilter(request, response)
+	response.ResponseWriter = recorder.ResponseWriter
+	if recorder.status >= http.StatusInternalServerError || recorder.status == http.StatusConflict ||
+		recorder.status == http.StatusTooManyRequests {
+		// the key is released for retries of failures, conflicts and rate limited requests
+		i.release(record)
+		return
+	}
+	header, _ := json.Marshal(recorder.header)
+	err = i.DB.Model(record).Updates(map[string]interface{}{
+		"completed": true,
+		"status":    recorder.status,
+		"header":    string(header),
+		"body":      recorder.body.Bytes(),
+	}).Error
+	if err != nil {
+		// the response is not replayed, the key is released for retries
+		i.release(record)
+	}
+}
+
+// release delete the pending record, it is taken again after LockTimeout if it can not be deleted
+func (i *Idempotency) release(record *IdempotencyRecord) {
+	i.DB.Where("id = ? AND completed = ?", record.ID, false).Delete(&IdempotencyRecord{})
+}
+
+// acquire insert the pending record, the existing record of the key is returned if it is not expired,
+// the pending one expires after LockTimeout
+func (i *Idempotency) acquire(record *IdempotencyRecord) (*IdempotencyRecord, error) {
+	lockTimeout := i.LockTimeout
+	if lockTimeout <= 0 {
+		lockTimeout = time.Minute
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := i.DB.Create(record).Error; err == nil {
+			return nil, nil
+		}
+		existing := &IdempotencyRecord{}
+		err := i.DB.Where("id = ?", record.ID).First(existing).Error
+		if err == gorm.ErrRecordNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		locked := now.Add(-lockTimeout)
+		if existing.ExpiresAt.After(now) && (existing.Completed || existing.CreatedAt.After(locked)) {
+			return existing, nil
+		}
+		err = i.DB.Where("id = ? AND (expires_at < ? OR (completed = ? AND created_at < ?))", record.ID, now, false, locked).
+			Delete(&IdempotencyRecord{}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the key is taken by a concurrent request again
+	return nil, errIdempotencyInProgress
+}
+
+// replay write the response of the existing record
+func (i *Idempotency) replay(response *restful.Response, record *IdempotencyRecord, existing *IdempotencyRecord) {
+	if !existing.Completed {
+		writeResult(response, errorResult(http.StatusConflict, "idempotency", errIdempotencyInProgress))
+		return
+	}
+	if existing.RequestHash != record.RequestHash {
+		writeResult(response, errorResult(http.StatusUnprocessableEntity, "idempotency", errIdempotencyMismatch))
+		return
+	}
+	header := http.Header{}
+	json.Unmarshal([]byte(existing.Header), &header)
+	for key, values := range header {
+		response.Header()[key] = values
+	}
+	response.Header().Set(HeaderIdempotentReplayed, "true")
+	response.WriteHeader(existing.Status)
+	response.Write(existing.Body)
+}
+
+// principal is scope of keys of the request
+func (i *Idempotency) principal(request *restful.Request) string {
+	if i.Principal != nil {
+		return i.Principal(request)
+	}
+	if principal := PrincipalFromRequest(request.Request); principal != nil {
+		return principal.Tenant + "/" + principal.ID
+	}
+	return ""
+}
+
+// responseRecorder record status, header and body of the response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	header      http.Header
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+// WriteHeader record the status and header
+func (r *responseRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.wroteHeader = true
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write record the body
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
@@ -0,0 +1,71 @@
+package grest_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestIdempotency(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	idempotency := grest.NewIdempotency(h.DB, time.Hour)
+	idempotency.Principal = func(request *restful.Request) string { return request.HeaderParameter("X-User") }
+	if err := idempotency.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	h.AddResource(&Doc{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{idempotency.Filter}})
+
+	first, replayed := &Doc{}, &Doc{}
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k1").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK).JSON(first)
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k1").JSON(&Doc{Title: "a"}).Expect().
+		Status(http.StatusOK).Header(grest.HeaderIdempotentReplayed, "true").JSON(replayed)
+	if first.ID == 0 || replayed.ID != first.ID {
+		t.Fatalf("expected replayed doc %d, got %d", first.ID, replayed.ID)
+	}
+	h.GET("/doc").Expect().Count(1)
+
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k1").JSON(&Doc{Title: "b"}).Expect().Status(http.StatusUnprocessableEntity)
+	// keys are scoped by principal
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k1").Header("X-User", "u2").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Expect().Count(2)
+
+	// a request with the key is in progress
+	h.DB.Create(&grest.IdempotencyRecord{ID: idempotencyID("", "k2"), Key: "k2", RequestHash: "pending", ExpiresAt: time.Now().Add(time.Hour)})
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k2").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusConflict)
+	// the expired key is taken again
+	h.DB.Model(&grest.IdempotencyRecord{}).Where("idempotency_key = ?", "k2").Update("expires_at", time.Now().Add(-time.Second))
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k2").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Expect().Count(3)
+	// the pending key is taken again after the lock timeout
+	h.DB.Create(&grest.IdempotencyRecord{ID: idempotencyID("", "k3"), Key: "k3", RequestHash: "pending", ExpiresAt: time.Now().Add(time.Hour),
+		CreatedAt: time.Now().Add(-2 * time.Minute)})
+	h.POST("/doc").Header(grest.HeaderIdempotencyKey, "k3").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Expect().Count(4)
+
+	// the key of the rate limited request is released
+	limit := grest.NewRateLimit(grest.Rate{Limit: 1, Period: time.Hour})
+	h.AddResource(&Note{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{idempotency.Filter, limit.Filter}})
+	h.POST("/note").Header(grest.HeaderIdempotencyKey, "k4").JSON(&Note{Title: "a"}).Expect().Status(http.StatusOK)
+	h.POST("/note").Header(grest.HeaderIdempotencyKey, "k5").JSON(&Note{Title: "a"}).Expect().Status(http.StatusTooManyRequests)
+	count := 0
+	h.DB.Model(&grest.IdempotencyRecord{}).Where("idempotency_key = ?", "k5").Count(&count)
+	if count != 0 {
+		t.Fatalf("key of the rate limited request is kept")
+	}
+
+	if err := idempotency.Purge(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func idempotencyID(principal, key string) string {
+	sum := sha256.Sum256([]byte(principal + "\n" + key))
+	return hex.EncodeToString(sum[:])
+}
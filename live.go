@@ -0,0 +1,385 @@
+package grest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/gorilla/websocket"
+)
+
+// Types of LiveMessage sent by the server, changes are sent with their EventType
+const (
+	LiveSnapshot     = "snapshot"
+	LiveReset        = "reset"
+	LiveError        = "error"
+	LiveUnsubscribed = "unsubscribed"
+)
+
+var (
+	errLiveMessage       = errors.New("message must subscribe or unsubscribe")
+	errLiveNoStream      = errors.New("resource has no stream")
+	errLiveSubscribed    = errors.New("subscription id is in use")
+	errLiveSubscriptions = errors.New("too many subscriptions")
+	errLiveClosed        = errors.New("socket is closed")
+)
+
+// LiveMessage is message of the live query socket
+// clients send {"id":"1","subscribe":"user","filter":{...}} and {"unsubscribe":"1"},
+// the server sends snapshot, created, updated, deleted, reset and error messages with the subscription id
+type LiveMessage struct {
+	ID          string          `json:"id,omitempty"`
+	Subscribe   string          `json:"subscribe,omitempty"`
+	Unsubscribe string          `json:"unsubscribe,omitempty"`
+	Filter      json.RawMessage `json:"filter,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	Count       int             `json:"count,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"`
+}
+
+// Live is WebSocket endpoint of live queries, one socket subscribes resources having Stream
+// a subscription receives the FindMany snapshot of its filter and then the matching changes,
+// reset means changes are lost and the client should subscribe again
+type Live struct {
+	API      *API
+	Upgrader websocket.Upgrader
+	// Heartbeat is interval of pings, the socket is closed without pong in two intervals, default is 30 seconds
+	Heartbeat time.Duration
+	// SendBuffer is number of messages buffered per socket, a socket too slow to receive is closed, default is 256
+	SendBuffer int
+	// MaxSubscriptions limit subscriptions per socket, 0 is unlimited
+	MaxSubscriptions int
+	// MaxMessageSize is max bytes of a client message, the socket is closed if it is exceeded, default is 64KB
+	MaxMessageSize int64
+	WS             *restful.WebService
+}
+
+// AddLiveService register the live query WebSocket, default path is live
+// the principal is authenticated by Middleware the same way as resources, e.g. Auth.Filter
+func (api *API) AddLiveService(configs ...ResourceConfig) (*Live, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	urlPath := strings.Trim(config.Path, "/")
+	if urlPath == "" {
+		urlPath = "live"
+	}
+	live := &Live{API: api, Heartbeat: 30 * time.Second, SendBuffer: 256, MaxMessageSize: 64 << 10}
+	live.WS = new(restful.WebService)
+	live.WS.Path("/" + urlPath).Produces(restful.MIME_JSON)
+	for _, filter := range config.Middleware {
+		live.WS.Filter(filter)
+	}
+	live.WS.Route(live.WS.GET("").To(live.Serve).
+		Doc("live queries over WebSocket").Metadata(restfulspec.KeyOpenAPITags, []string{"live"}).
+		Returns(http.StatusSwitchingProtocols, "switching protocols", LiveMessage{}))
+	if err := api.add(live.WS); err != nil {
+		return nil, err
+	}
+	return live, nil
+}
+
+// Serve upgrade the request and serve the socket until it is closed
+func (live *Live) Serve(request *restful.Request, response *restful.Response) {
+	conn, err := live.Upgrader.Upgrade(response.ResponseWriter, request.Request, nil)
+	if err != nil {
+		// Upgrade has replied the error
+		return
+	}
+	size := live.SendBuffer
+	if size <= 0 {
+		size = 256
+	}
+	c := &liveConn{
+		live:    live,
+		conn:    conn,
+		request: request,
+		send:    make(chan *LiveMessage, size),
+		done:    make(chan struct{}),
+		subs:    map[string]*liveSub{},
+	}
+	go c.writeLoop()
+	c.readLoop()
+}
+
+// heartbeat is ping interval of the socket
+func (live *Live) heartbeat() time.Duration {
+	if live.Heartbeat <= 0 {
+		return 30 * time.Second
+	}
+	return live.Heartbeat
+}
+
+// liveConn is a live query socket and its subscriptions
+type liveConn struct {
+	live    *Live
+	conn    *websocket.Conn
+	request *restful.Request
+	send    chan *LiveMessage
+	done    chan struct{}
+	once    sync.Once
+
+	mu   sync.Mutex
+	subs map[string]*liveSub
+}
+
+// liveSub is subscription of the socket
+type liveSub struct {
+	cancel func()
+}
+
+// close send the close frame and close the socket once
+func (c *liveConn) close(code int, text string) {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(time.Second))
+		c.conn.Close()
+	})
+}
+
+// push queue the message, the socket is closed if its buffer is full
+func (c *liveConn) push(msg *LiveMessage) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.close(websocket.CloseTryAgainLater, "slow consumer")
+		return false
+	}
+}
+
+// pushError queue error message of the result
+func (c *liveConn) pushError(id string, result *Result) {
+	data, _ := json.Marshal(result.Entity)
+	c.push(&LiveMessage{ID: id, Type: LiveError, Data: data})
+}
+
+// writeLoop write queued messages and pings
+func (c *liveConn) writeLoop() {
+	heartbeat := c.live.heartbeat()
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(heartbeat))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseInternalServerErr, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(heartbeat)); err != nil {
+				c.close(websocket.CloseGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// readLoop handle client messages until the socket is closed, then cancel the subscriptions
+func (c *liveConn) readLoop() {
+	defer func() {
+		c.mu.Lock()
+		subs := c.subs
+		c.subs = nil
+		c.mu.Unlock()
+		for _, sub := range subs {
+			sub.cancel()
+		}
+		c.close(websocket.CloseNormalClosure, "")
+	}()
+	limit := c.live.MaxMessageSize
+	if limit <= 0 {
+		limit = 64 << 10
+	}
+	c.conn.SetReadLimit(limit)
+	deadline := 2 * c.live.heartbeat()
+	c.conn.SetReadDeadline(time.Now().Add(deadline))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(deadline))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		msg := new(LiveMessage)
+		if err := json.Unmarshal(data, msg); err != nil {
+			c.pushError("", errorResult(http.StatusBadRequest, "live", err))
+			continue
+		}
+		switch {
+		case msg.Subscribe != "":
+			c.subscribe(msg)
+		case msg.Unsubscribe != "":
+			c.unsubscribe(msg.Unsubscribe)
+		default:
+			c.pushError(msg.ID, errorResult(http.StatusBadRequest, "live", errLiveMessage))
+		}
+	}
+}
+
+// subscribe reserve the subscription, the snapshot is queried by another goroutine,
+// so the read loop keeps handling pongs and unsubscribes
+func (c *liveConn) subscribe(msg *LiveMessage) {
+	id := msg.ID
+	if id == "" {
+		id = msg.Subscribe
+	}
+	res := c.live.API.GetResource(msg.Subscribe)
+	if res == nil {
+		c.pushError(id, errorResult(http.StatusNotFound, "subscribe", errNotFound))
+		return
+	}
+	g := res.View
+	if g.Stream == nil {
+		c.pushError(id, errorResult(http.StatusBadRequest, "subscribe", errLiveNoStream))
+		return
+	}
+	// subscribe before the snapshot, changes during the query are not lost
+	_, _, events, cancel := g.Stream.Subscribe(0)
+	sub := &liveSub{cancel: cancel}
+	c.mu.Lock()
+	var err error
+	switch _, exists := c.subs[id]; {
+	case c.subs == nil:
+		err = errLiveClosed
+	case exists:
+		err = NewHTTPError(http.StatusConflict, errLiveSubscribed)
+	case c.live.MaxSubscriptions > 0 && len(c.subs) >= c.live.MaxSubscriptions:
+		err = NewHTTPError(http.StatusBadRequest, errLiveSubscriptions)
+	default:
+		c.subs[id] = sub
+	}
+	c.mu.Unlock()
+	if err != nil {
+		cancel()
+		if err != errLiveClosed {
+			c.pushError(id, errorResult(http.StatusBadRequest, "subscribe", err))
+		}
+		return
+	}
+	go c.snapshot(id, sub, g, msg.Filter, events)
+}
+
+// snapshot send snapshot of the filter and forward matching changes of the resource,
+// the subscription is dropped if it fails
+func (c *liveConn) snapshot(id string, sub *liveSub, g *GenericAPIView, rawFilter json.RawMessage, events chan *StreamEvent) {
+	fail := func(result *Result) {
+		if c.drop(id, sub) {
+			c.pushError(id, result)
+		}
+	}
+	cxt, err := g.newContext(c.request, nil)
+	if err != nil {
+		fail(errorResult(http.StatusBadRequest, "request context", err))
+		return
+	}
+	decision, denied := g.authorize(cxt, ActionList)
+	if denied != nil {
+		fail(denied)
+		return
+	}
+	filter, err := ParseFilter(string(rawFilter))
+	if err != nil {
+		fail(errorResult(http.StatusBadRequest, "subscribe", err))
+		return
+	}
+	matcher, err := NewMatcher(filter.Where)
+	if err != nil {
+		fail(errorResult(http.StatusBadRequest, "subscribe", err))
+		return
+	}
+	listCxt, err := g.newContext(c.request, nil)
+	if err != nil {
+		fail(errorResult(http.StatusBadRequest, "request context", err))
+		return
+	}
+	result := g.list(listCxt, string(rawFilter))
+	if result.Status != http.StatusOK {
+		fail(result)
+		return
+	}
+	data, err := json.Marshal(result.Entity)
+	if err != nil {
+		fail(errorResult(http.StatusInternalServerError, "subscribe", err))
+		return
+	}
+	count, _ := strconv.Atoi(result.Header.Get("count"))
+
+	// the snapshot is not sent after unsubscribing
+	c.mu.Lock()
+	active := c.subs[id] == sub
+	if active {
+		c.push(&LiveMessage{ID: id, Type: LiveSnapshot, Count: count, Data: data})
+	}
+	c.mu.Unlock()
+	if active {
+		c.forward(id, sub, g, cxt, matcher, decision, events)
+	}
+}
+
+// drop remove and cancel the subscription, false if it is removed already
+func (c *liveConn) drop(id string, sub *liveSub) bool {
+	c.mu.Lock()
+	active := c.subs[id] == sub
+	if active {
+		delete(c.subs, id)
+	}
+	c.mu.Unlock()
+	if active {
+		sub.cancel()
+	}
+	return active
+}
+
+// forward push matching changes of the subscription
+// reset is sent if the stream drops the subscription for being too slow
+func (c *liveConn) forward(id string, sub *liveSub, g *GenericAPIView, cxt *Context, matcher *Matcher, decision *Decision, events chan *StreamEvent) {
+	for event := range events {
+		data, ok, err := g.streamData(event, cxt, matcher, decision)
+		if err != nil || !ok {
+			continue
+		}
+		if !c.push(&LiveMessage{ID: id, Type: string(event.Event.Type), Data: data}) {
+			return
+		}
+	}
+	c.mu.Lock()
+	active := c.subs[id] == sub
+	if active {
+		delete(c.subs, id)
+	}
+	c.mu.Unlock()
+	if active {
+		c.push(&LiveMessage{ID: id, Type: LiveReset})
+	}
+}
+
+// unsubscribe cancel the subscription
+func (c *liveConn) unsubscribe(id string) {
+	c.mu.Lock()
+	sub, ok := c.subs[id]
+	delete(c.subs, id)
+	c.mu.Unlock()
+	if !ok {
+		c.pushError(id, errorResult(http.StatusNotFound, "unsubscribe", errNotFound))
+		return
+	}
+	sub.cancel()
+	c.push(&LiveMessage{ID: id, Type: LiveUnsubscribed})
+}
@@ -0,0 +1,92 @@
+package grest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/gorilla/websocket"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestLive(t *testing.T) {
+	auth := grest.NewAuth(true, &grest.APIKeyAuth{Store: grest.APIKeys{
+		"reader": {ID: "reader", Scopes: []string{"doc:read"}},
+		"guest":  {ID: "guest"},
+	}})
+	h := gresttest.New(t)
+	defer h.Close()
+	middleware := []restful.FilterFunction{auth.Filter}
+	h.AddResource(&Doc{}, grest.ResourceConfig{
+		Middleware: middleware,
+		Stream:     grest.NewStream(10),
+		Scopes:     map[grest.Action][]string{grest.ActionList: {"doc:read"}},
+	})
+	live, err := h.API.AddLiveService(grest.ResourceConfig{Middleware: middleware})
+	if err != nil {
+		t.Fatal(err)
+	}
+	live.Heartbeat = 50 * time.Millisecond
+
+	url := "ws" + strings.TrimPrefix(h.Server.URL, "http") + "/live"
+	if _, resp, err := websocket.DefaultDialer.Dial(url, nil); err == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected unauthorized, got %v", err)
+	}
+	dial := func(key string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{grest.APIKeyHeader: {key}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		return conn
+	}
+	receive := func(conn *websocket.Conn, typ string) *grest.LiveMessage {
+		msg := new(grest.LiveMessage)
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Type != typ {
+			t.Fatalf("expected %s, got %+v %s", typ, msg, msg.Data)
+		}
+		return msg
+	}
+
+	h.POST("/doc").Header(grest.APIKeyHeader, "reader").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	conn := dial("reader")
+	defer conn.Close()
+	conn.WriteJSON(map[string]interface{}{"id": "s1", "subscribe": "doc", "filter": map[string]interface{}{"where": []interface{}{"title <> ?", "x"}}})
+	if msg := receive(conn, grest.LiveSnapshot); msg.ID != "s1" || msg.Count != 1 || !strings.Contains(string(msg.Data), `"a"`) {
+		t.Fatalf("unexpected snapshot %+v %s", msg, msg.Data)
+	}
+	h.POST("/doc").Header(grest.APIKeyHeader, "reader").JSON(&Doc{Title: "x"}).Expect().Status(http.StatusOK)
+	h.POST("/doc").Header(grest.APIKeyHeader, "reader").JSON(&Doc{Title: "b"}).Expect().Status(http.StatusOK)
+	if msg := receive(conn, string(grest.EventCreated)); msg.ID != "s1" || !strings.Contains(string(msg.Data), `"b"`) {
+		t.Fatalf("unexpected change %+v %s", msg, msg.Data)
+	}
+
+	conn.WriteJSON(&grest.LiveMessage{Subscribe: "doc", ID: "s1"})
+	receive(conn, grest.LiveError)
+	conn.WriteJSON(&grest.LiveMessage{Subscribe: "nothing"})
+	receive(conn, grest.LiveError)
+	conn.WriteJSON(&grest.LiveMessage{Unsubscribe: "s1"})
+	receive(conn, grest.LiveUnsubscribed)
+
+	// the socket is closed by a message over MaxMessageSize
+	live.MaxMessageSize = 1024
+	large := dial("reader")
+	defer large.Close()
+	large.WriteJSON(&grest.LiveMessage{Subscribe: "doc", Filter: []byte(`"` + strings.Repeat("a", 2048) + `"`)})
+	if _, _, err := large.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Fatalf("expected close of too big message, got %v", err)
+	}
+
+	guest := dial("guest")
+	defer guest.Close()
+	guest.WriteJSON(&grest.LiveMessage{Subscribe: "doc"})
+	if msg := receive(guest, grest.LiveError); !strings.Contains(string(msg.Data), "403") {
+		t.Fatalf("expected forbidden, got %s", msg.Data)
+	}
+}
@@ -0,0 +1,779 @@
+package grest
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Matcher evaluates where condition of Filter in Go
+// it supports =, !=, <>, <, <=, >, >=, [NOT] IN, [NOT] LIKE, IS [NOT] NULL, [NOT] BETWEEN,
+// AND, OR, NOT and parentheses, e.g. ["name = ? AND (age > ? OR vip)", "grest", 18]
+// a JSON object as condition matches columns by equality, e.g. [{"name": "grest"}]
+type Matcher struct {
+	expr matchNode
+}
+
+// NewMatcher compile where condition, empty condition matches everything
+func NewMatcher(where []interface{}) (*Matcher, error) {
+	if len(where) == 0 {
+		return &Matcher{}, nil
+	}
+	switch cond := where[0].(type) {
+	case string:
+		if strings.TrimSpace(cond) == "" {
+			return &Matcher{}, nil
+		}
+		p := &matchParser{args: where[1:]}
+		if err := p.tokenize(cond); err != nil {
+			return nil, err
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos < len(p.tokens) {
+			return nil, fmt.Errorf("where format is incorrect, unexpected %q", p.tokens[p.pos].text)
+		}
+		return &Matcher{expr: expr}, nil
+	case map[string]interface{}:
+		var expr matchNode
+		keys := make([]string, 0, len(cond))
+		for key := range cond {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			var node matchNode
+			if cond[key] == nil {
+				node = &nullNode{operand: columnRef(key)}
+			} else {
+				node = &compareNode{op: "=", left: columnRef(key), right: literal{cond[key]}}
+			}
+			if expr == nil {
+				expr = node
+			} else {
+				expr = &logicNode{and: true, left: expr, right: node}
+			}
+		}
+		return &Matcher{expr: expr}, nil
+	}
+	return nil, fmt.Errorf("where format is incorrect, condition %T is not supported", where[0])
+}
+
+// Match check the record matches the condition
+// record is a struct, a struct pointer or a map of column values
+func (m *Matcher) Match(record interface{}) bool {
+	if m == nil || m.expr == nil {
+		return true
+	}
+	return m.expr.eval(NewRecordValues(record))
+}
+
+// RecordValues is column values of a record, it can be looked up by column, json or field name
+type RecordValues map[string]interface{}
+
+// NewRecordValues is create RecordValues of struct or map
+func NewRecordValues(record interface{}) RecordValues {
+	if values, ok := record.(RecordValues); ok {
+		return values
+	}
+	if values, ok := record.(map[string]interface{}); ok {
+		return RecordValues(values)
+	}
+	values := RecordValues{}
+	if !Indirect(reflect.ValueOf(record)).IsValid() {
+		return values
+	}
+	scope := gorm.Scope{Value: record}
+	for _, field := range scope.Fields() {
+		if field.IsIgnored || !field.IsNormal {
+			continue
+		}
+		value := field.Field.Interface()
+		values[field.Name] = value
+		values[field.DBName] = value
+		if name := strings.Split(field.Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			values[name] = value
+		}
+	}
+	return values
+}
+
+// Get get value by column name, table prefix and case are ignored if no exact match
+func (values RecordValues) Get(name string) (interface{}, bool) {
+	if value, ok := values[name]; ok {
+		return value, true
+	}
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+		if value, ok := values[name]; ok {
+			return value, true
+		}
+	}
+	for key, value := range values {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+// matchNode is node of where expression
+type matchNode interface {
+	eval(values RecordValues) bool
+}
+
+// operand is value in where expression
+type operand interface {
+	value(values RecordValues) interface{}
+}
+
+type columnRef string
+
+func (c columnRef) value(values RecordValues) interface{} {
+	value, _ := values.Get(string(c))
+	return value
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) value(values RecordValues) interface{} {
+	return l.v
+}
+
+type logicNode struct {
+	and         bool
+	left, right matchNode
+}
+
+func (n *logicNode) eval(values RecordValues) bool {
+	if n.and {
+		return n.left.eval(values) && n.right.eval(values)
+	}
+	return n.left.eval(values) || n.right.eval(values)
+}
+
+type notNode struct {
+	node matchNode
+}
+
+func (n *notNode) eval(values RecordValues) bool {
+	return !n.node.eval(values)
+}
+
+type compareNode struct {
+	op          string
+	left, right operand
+}
+
+func (n *compareNode) eval(values RecordValues) bool {
+	c, ok := CompareValues(n.left.value(values), n.right.value(values))
+	if !ok {
+		return false
+	}
+	switch n.op {
+	case "=", "==":
+		return c == 0
+	case "!=", "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+type inNode struct {
+	operand operand
+	list    []operand
+	not     bool
+}
+
+func (n *inNode) eval(values RecordValues) bool {
+	v := n.operand.value(values)
+	if v == nil {
+		return false
+	}
+	for _, item := range n.list {
+		for _, each := range expandList(item.value(values)) {
+			if c, ok := CompareValues(v, each); ok && c == 0 {
+				return !n.not
+			}
+		}
+	}
+	return n.not
+}
+
+type likeNode struct {
+	operand operand
+	pattern operand
+	not     bool
+}
+
+func (n *likeNode) eval(values RecordValues) bool {
+	v, p := n.operand.value(values), n.pattern.value(values)
+	if v == nil || p == nil {
+		return false
+	}
+	return likeRegexp(fmt.Sprint(normalizeValue(p))).MatchString(fmt.Sprint(normalizeValue(v))) != n.not
+}
+
+type nullNode struct {
+	operand operand
+	not     bool
+}
+
+func (n *nullNode) eval(values RecordValues) bool {
+	return (normalizeValue(n.operand.value(values)) == nil) != n.not
+}
+
+type betweenNode struct {
+	operand operand
+	low     operand
+	high    operand
+	not     bool
+}
+
+func (n *betweenNode) eval(values RecordValues) bool {
+	v := n.operand.value(values)
+	low, ok1 := CompareValues(v, n.low.value(values))
+	high, ok2 := CompareValues(v, n.high.value(values))
+	if !ok1 || !ok2 {
+		return false
+	}
+	return (low >= 0 && high <= 0) != n.not
+}
+
+// truthNode is a lone operand, e.g. "active"
+type truthNode struct {
+	operand operand
+}
+
+func (n *truthNode) eval(values RecordValues) bool {
+	c, ok := CompareValues(n.operand.value(values), 0)
+	return ok && c != 0
+}
+
+// expandList expand slice argument of IN
+func expandList(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		list := make([]interface{}, rv.Len())
+		for i := range list {
+			list[i] = rv.Index(i).Interface()
+		}
+		return list
+	}
+	return []interface{}{v}
+}
+
+// likeRegexp convert LIKE pattern to case insensitive regexp
+func likeRegexp(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
+
+// normalizeValue dereference pointers and driver values, numbers become float64
+func normalizeValue(v interface{}) interface{} {
+	for {
+		if v == nil {
+			return nil
+		}
+		if valuer, ok := v.(driver.Valuer); ok {
+			if _, isTime := v.(time.Time); !isTime {
+				dv, err := valuer.Value()
+				if err != nil {
+					return nil
+				}
+				v = dv
+				continue
+			}
+		}
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if rv.IsNil() {
+				return nil
+			}
+			v = rv.Elem().Interface()
+			continue
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return float64(rv.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return float64(rv.Uint())
+		case reflect.Float32, reflect.Float64:
+			return rv.Float()
+		case reflect.String:
+			return rv.String()
+		case reflect.Bool:
+			return rv.Bool()
+		case reflect.Slice:
+			if rv.Type().Elem().Kind() == reflect.Uint8 {
+				return string(rv.Bytes())
+			}
+		}
+		return v
+	}
+}
+
+// CompareValues compare two values the way databases do loosely,
+// ok is false if one is NULL or they are not comparable
+func CompareValues(a, b interface{}) (int, bool) {
+	a, b = normalizeValue(a), normalizeValue(b)
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := toTime(b)
+		if !ok {
+			return 0, false
+		}
+		return compareTime(ta, tb), true
+	}
+	if tb, ok := b.(time.Time); ok {
+		ta, ok := toTime(a)
+		if !ok {
+			return 0, false
+		}
+		return compareTime(ta, tb), true
+	}
+
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	_, strA := a.(string)
+	_, strB := b.(string)
+	if okA && okB && !(strA && strB) {
+		switch {
+		case fa < fb:
+			return -1, true
+		case fa > fb:
+			return 1, true
+		}
+		return 0, true
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch value := v.(type) {
+	case float64:
+		return value, true
+	case bool:
+		if value {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch value := v.(type) {
+	case time.Time:
+		return value, true
+	case string:
+		t, err := ParseTime(value, nil)
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func compareTime(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// matchToken is token of where expression
+type matchToken struct {
+	kind string // ident, string, number, param, op, keyword, lparen, rparen, comma
+	text string
+}
+
+// matchParser is recursive descent parser of where expression
+type matchParser struct {
+	tokens []matchToken
+	pos    int
+	args   []interface{}
+	argPos int
+}
+
+var matchKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "LIKE": true, "IS": true,
+	"NULL": true, "BETWEEN": true, "TRUE": true, "FALSE": true,
+}
+
+func (p *matchParser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, matchToken{kind: "lparen", text: "("})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, matchToken{kind: "rparen", text: ")"})
+			i++
+		case c == ',':
+			p.tokens = append(p.tokens, matchToken{kind: "comma", text: ","})
+			i++
+		case c == '?':
+			p.tokens = append(p.tokens, matchToken{kind: "param", text: "?"})
+			i++
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			var b strings.Builder
+			for ; j < len(s); j++ {
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						b.WriteByte(c)
+						j++
+						continue
+					}
+					break
+				}
+				b.WriteByte(s[j])
+			}
+			if j >= len(s) {
+				return fmt.Errorf("where format is incorrect, unterminated quote at %d", i)
+			}
+			kind := "string"
+			if c == '`' {
+				kind = "ident"
+			}
+			p.tokens = append(p.tokens, matchToken{kind: kind, text: b.String()})
+			i = j + 1
+		case strings.ContainsRune("=!<>", rune(c)):
+			j := i + 1
+			if j < len(s) && strings.ContainsRune("=>", rune(s[j])) {
+				j++
+			}
+			op := s[i:j]
+			if op == "!" {
+				return fmt.Errorf("where format is incorrect, unexpected ! at %d", i)
+			}
+			p.tokens = append(p.tokens, matchToken{kind: "op", text: op})
+			i = j
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == 'e' || s[j] == 'E' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			p.tokens = append(p.tokens, matchToken{kind: "number", text: s[i:j]})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			word := s[i:j]
+			if matchKeywords[strings.ToUpper(word)] {
+				p.tokens = append(p.tokens, matchToken{kind: "keyword", text: strings.ToUpper(word)})
+			} else {
+				p.tokens = append(p.tokens, matchToken{kind: "ident", text: word})
+			}
+			i = j
+		default:
+			return fmt.Errorf("where format is incorrect, unexpected %q at %d", c, i)
+		}
+	}
+	return nil
+}
+
+func (p *matchParser) peek() *matchToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+func (p *matchParser) acceptKeyword(keyword string) bool {
+	if t := p.peek(); t != nil && t.kind == "keyword" && t.text == keyword {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *matchParser) accept(kind string) bool {
+	if t := p.peek(); t != nil && t.kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *matchParser) parseOr() (matchNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *matchParser) parseAnd() (matchNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *matchParser) parseNot() (matchNode, error) {
+	if p.acceptKeyword("NOT") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{node: node}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *matchParser) parsePrimary() (matchNode, error) {
+	if p.accept("lparen") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept("rparen") {
+			return nil, fmt.Errorf("where format is incorrect, missing )")
+		}
+		return node, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	if t == nil || t.kind == "rparen" || (t.kind == "keyword" && (t.text == "AND" || t.text == "OR")) {
+		return &truthNode{operand: left}, nil
+	}
+	if t.kind == "op" {
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: t.text, left: left, right: right}, nil
+	}
+
+	if p.acceptKeyword("IS") {
+		not := p.acceptKeyword("NOT")
+		if !p.acceptKeyword("NULL") {
+			return nil, fmt.Errorf("where format is incorrect, IS must be followed by NULL")
+		}
+		return &nullNode{operand: left, not: not}, nil
+	}
+
+	not := p.acceptKeyword("NOT")
+	switch {
+	case p.acceptKeyword("IN"):
+		node := &inNode{operand: left, not: not}
+		if p.accept("lparen") {
+			for {
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				node.list = append(node.list, item)
+				if !p.accept("comma") {
+					break
+				}
+			}
+			if !p.accept("rparen") {
+				return nil, fmt.Errorf("where format is incorrect, missing ) of IN")
+			}
+		} else {
+			item, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			node.list = append(node.list, item)
+		}
+		return node, nil
+	case p.acceptKeyword("LIKE"):
+		pattern, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &likeNode{operand: left, pattern: pattern, not: not}, nil
+	case p.acceptKeyword("BETWEEN"):
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		if !p.acceptKeyword("AND") {
+			return nil, fmt.Errorf("where format is incorrect, BETWEEN must be followed by AND")
+		}
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return &betweenNode{operand: left, low: low, high: high, not: not}, nil
+	}
+	return nil, fmt.Errorf("where format is incorrect, unexpected %q", t.text)
+}
+
+func (p *matchParser) parseOperand() (operand, error) {
+	t := p.peek()
+	if t == nil {
+		return nil, fmt.Errorf("where format is incorrect, unexpected end")
+	}
+	p.pos++
+	switch t.kind {
+	case "ident":
+		return columnRef(t.text), nil
+	case "string":
+		return literal{t.text}, nil
+	case "number":
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("where format is incorrect, %v", err)
+		}
+		return literal{f}, nil
+	case "param":
+		if p.argPos >= len(p.args) {
+			return nil, fmt.Errorf("where format is incorrect, not enough arguments")
+		}
+		arg := p.args[p.argPos]
+		p.argPos++
+		return literal{arg}, nil
+	case "keyword":
+		switch t.text {
+		case "NULL":
+			return literal{nil}, nil
+		case "TRUE":
+			return literal{true}, nil
+		case "FALSE":
+			return literal{false}, nil
+		}
+	case "lparen":
+		// parenthesized operand list is only valid after IN, handled by caller
+		p.pos--
+	}
+	return nil, fmt.Errorf("where format is incorrect, unexpected %q", t.text)
+}
+
+// SortRecords sort records by order clause, e.g. "name desc, id"
+// records is slice of struct, struct pointer or map
+func SortRecords(records interface{}, order string) error {
+	type orderBy struct {
+		column string
+		desc   bool
+	}
+	var orders []orderBy
+	for _, part := range strings.Split(order, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		o := orderBy{column: strings.Trim(fields[0], "`\"")}
+		if len(fields) > 1 {
+			switch strings.ToUpper(fields[1]) {
+			case "DESC":
+				o.desc = true
+			case "ASC":
+			default:
+				return fmt.Errorf("order format is incorrect, %s", part)
+			}
+		}
+		if len(fields) > 2 {
+			return fmt.Errorf("order format is incorrect, %s", part)
+		}
+		orders = append(orders, o)
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(records))
+	values := make([]RecordValues, rv.Len())
+	for i := range values {
+		values[i] = NewRecordValues(rv.Index(i).Interface())
+	}
+	index := make([]int, rv.Len())
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		for _, o := range orders {
+			a, _ := values[index[i]].Get(o.column)
+			b, _ := values[index[j]].Get(o.column)
+			c, ok := CompareValues(a, b)
+			if !ok {
+				// NULL first, like most databases in ascending order
+				an, bn := normalizeValue(a) == nil, normalizeValue(b) == nil
+				if an == bn {
+					continue
+				}
+				return an != o.desc
+			}
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != o.desc
+		}
+		return false
+	})
+
+	sorted := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+	for i, idx := range index {
+		sorted.Index(i).Set(rv.Index(idx))
+	}
+	reflect.Copy(rv, sorted)
+	return nil
+}
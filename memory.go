@@ -0,0 +1,288 @@
+package grest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+)
+
+var errMemoryWriteHooks = NewHTTPError(http.StatusNotImplemented, errors.New("write hooks are not supported by MemoryView"))
+
+// MemoryView is in-memory View, it evaluates the filter in Go with Matcher,
+// so resources can be served from fixtures, caches or tests without a database.
+// one MemoryView can hold records of many models, records are copied in and out.
+type MemoryView struct {
+	mu      sync.RWMutex
+	records map[reflect.Type][]reflect.Value
+	nextID  map[reflect.Type]uint64
+}
+
+// NewMemoryView is create MemoryView
+func NewMemoryView() *MemoryView {
+	return &MemoryView{records: map[reflect.Type][]reflect.Value{}, nextID: map[reflect.Type]uint64{}}
+}
+
+// Load save every element of the slice, e.g. fixtures
+func (m *MemoryView) Load(values interface{}) error {
+	rv := Indirect(reflect.ValueOf(values))
+	if rv.Kind() != reflect.Slice {
+		return fmt.Errorf("load values must be a slice, got %T", values)
+	}
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		if err := m.Save(item.Interface(), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindMany query data, joins, groups and preloads are not supported
+func (m *MemoryView) FindMany(result interface{}, filter *Filter, context *Context) (int, error) {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return 0, fmt.Errorf("result must be a pointer to slice, got %T", result)
+	}
+	if filter == nil {
+		filter = new(Filter)
+	}
+	if len(filter.Joins) > 0 || len(filter.Groups) > 0 || len(filter.Preloads) > 0 {
+		return 0, errors.New("joins, groups and preloads are not supported by memory view")
+	}
+	matcher, err := NewMatcher(filter.Where)
+	if err != nil {
+		return 0, err
+	}
+
+	sliceType := rv.Elem().Type()
+	modelType := ModelType(result)
+	matched := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(modelType)), 0, 0)
+	m.mu.RLock()
+	for _, record := range m.records[modelType] {
+		copied := reflect.New(modelType)
+		copied.Elem().Set(record)
+		inScope, err := matchScopes(copied.Interface(), context)
+		if err != nil {
+			m.mu.RUnlock()
+			return 0, err
+		}
+		if inScope && matcher.Match(copied.Interface()) {
+			matched = reflect.Append(matched, copied)
+		}
+	}
+	m.mu.RUnlock()
+
+	if err := SortRecords(matched.Interface(), filter.Order); err != nil {
+		return 0, err
+	}
+
+	count := matched.Len()
+	start, end := 0, count
+	if filter.Limit != 0 {
+		// clamp the offset into [0, count]
+		start = filter.Offset
+		if start < 0 {
+			start = 0
+		} else if start > count {
+			start = count
+		}
+		if filter.Limit > 0 && start+filter.Limit < end {
+			end = start + filter.Limit
+		}
+	}
+
+	results := reflect.MakeSlice(sliceType, 0, end-start)
+	for i := start; i < end; i++ {
+		item := matched.Index(i)
+		if len(filter.Fields) > 0 {
+			item = selectFields(item, filter.Fields)
+		}
+		if sliceType.Elem().Kind() != reflect.Ptr {
+			item = item.Elem()
+		}
+		results = reflect.Append(results, item)
+	}
+	rv.Elem().Set(results)
+	return count, nil
+}
+
+// Save create or update data by its primary key, zero integer primary key is generated
+// commit hooks of the context run after the write, write hooks are not supported and fail the write
+func (m *MemoryView) Save(result interface{}, context *Context) error {
+	if context != nil && len(context.WriteHooks) > 0 {
+		return errMemoryWriteHooks
+	}
+	before, err := m.save(result, context)
+	if err != nil {
+		return err
+	}
+	if context != nil && len(context.CommitHooks) > 0 {
+		change := newChange(ActionCreate, result, context)
+		if before != nil {
+			change.Action = ActionUpdate
+			change.Before = before
+		}
+		change.After = copyValue(result)
+		change.ID = primaryKeyString(result)
+		runCommitHooks(change)
+	}
+	return nil
+}
+
+// save store the data, the replaced record is returned
+func (m *MemoryView) save(result interface{}, context *Context) (interface{}, error) {
+	rv := reflect.ValueOf(result)
+	if rv.Kind() != reflect.Ptr || Indirect(rv).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("result must be a pointer to struct, got %T", result)
+	}
+	modelType := ModelType(result)
+	scope := gorm.Scope{Value: result}
+	primaryField := scope.PrimaryField()
+	if primaryField == nil {
+		return nil, fmt.Errorf("%v has no primary key", modelType)
+	}
+
+	if err := stampTenant(result, context); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if primaryField.IsBlank {
+		switch primaryField.Field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			m.nextID[modelType]++
+			if err := primaryField.Set(m.nextID[modelType]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, errors.New("primary key is blank")
+		}
+	} else if id, ok := toFloat(normalizeValue(primaryField.Field.Interface())); ok && uint64(id) > m.nextID[modelType] {
+		m.nextID[modelType] = uint64(id)
+	}
+
+	record := reflect.New(modelType).Elem()
+	record.Set(Indirect(rv))
+	if i := m.indexOf(modelType, fmt.Sprint(primaryField.Field.Interface())); i >= 0 {
+		if err := m.checkScope(m.records[modelType][i], context); err != nil {
+			return nil, err
+		}
+		before := m.records[modelType][i].Addr().Interface()
+		m.records[modelType][i] = record
+		return before, nil
+	}
+	m.records[modelType] = append(m.records[modelType], record)
+	return nil, nil
+}
+
+// FindOne query data by the resource id of context
+func (m *MemoryView) FindOne(result interface{}, context *Context) error {
+	if context == nil || context.ResourceID == "" {
+		return errors.New("failed to find")
+	}
+	modelType := ModelType(result)
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := m.indexOf(modelType, context.ResourceID)
+	if i < 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.checkScope(m.records[modelType][i], context); err != nil {
+		return err
+	}
+	Indirect(reflect.ValueOf(result)).Set(m.records[modelType][i])
+	return nil
+}
+
+// Delete delete data by its primary key, commit hooks of the context run after the write,
+// write hooks are not supported and fail the write
+func (m *MemoryView) Delete(result interface{}, context *Context) error {
+	if context != nil && len(context.WriteHooks) > 0 {
+		return errMemoryWriteHooks
+	}
+	if err := m.delete(result, context); err != nil {
+		return err
+	}
+	if context != nil && len(context.CommitHooks) > 0 {
+		change := newChange(ActionDelete, result, context)
+		change.Before = copyValue(result)
+		change.ID = primaryKeyString(result)
+		runCommitHooks(change)
+	}
+	return nil
+}
+
+// delete remove the data, result is filled with the deleted record
+func (m *MemoryView) delete(result interface{}, context *Context) error {
+	modelType := ModelType(result)
+	scope := gorm.Scope{Value: result}
+	primaryField := scope.PrimaryField()
+	if primaryField == nil || primaryField.IsBlank {
+		return gorm.ErrRecordNotFound
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := m.indexOf(modelType, fmt.Sprint(primaryField.Field.Interface()))
+	if i < 0 {
+		return gorm.ErrRecordNotFound
+	}
+	if err := m.checkScope(m.records[modelType][i], context); err != nil {
+		return err
+	}
+	records := m.records[modelType]
+	Indirect(reflect.ValueOf(result)).Set(records[i])
+	m.records[modelType] = append(records[:i:i], records[i+1:]...)
+	return nil
+}
+
+// indexOf find record index by primary key, the caller must hold the lock
+func (m *MemoryView) indexOf(modelType reflect.Type, id string) int {
+	for i, record := range m.records[modelType] {
+		scope := gorm.Scope{Value: record.Addr().Interface()}
+		if primaryField := scope.PrimaryField(); primaryField != nil && fmt.Sprint(primaryField.Field.Interface()) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkScope report the record out of tenant or row scopes as not found
+func (m *MemoryView) checkScope(record reflect.Value, context *Context) error {
+	inScope, err := matchScopes(record.Addr().Interface(), context)
+	if err != nil {
+		return err
+	}
+	if !inScope {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// selectFields copy the selected columns into a new struct pointer
+func selectFields(item reflect.Value, fields []string) reflect.Value {
+	selected := reflect.New(item.Type().Elem())
+	from := gorm.Scope{Value: item.Interface()}
+	to := gorm.Scope{Value: selected.Interface()}
+	for _, name := range fields {
+		name = strings.Trim(strings.TrimSpace(name), "`\"")
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		if field, ok := from.FieldByName(name); ok {
+			if target, ok := to.FieldByName(name); ok {
+				target.Field.Set(field.Field)
+			}
+		}
+	}
+	return selected
+}
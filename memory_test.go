@@ -0,0 +1,134 @@
+package grest_test
+
+import (
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zhgqiang/grest"
+)
+
+type MemoryUser struct {
+	ID        uint   `json:"id" gorm:"primary_key"`
+	Name      string `json:"name"`
+	Age       int    `json:"age"`
+	CompanyID uint   `json:"companyId"`
+}
+
+func TMemoryView(t *testing.T) *grest.MemoryView {
+	view := grest.NewMemoryView()
+	err := view.Load([]MemoryUser{
+		{Name: "alice", Age: 30, CompanyID: 1},
+		{Name: "bob", Age: 20, CompanyID: 1},
+		{Name: "carol", Age: 40, CompanyID: 2},
+		{Name: "dave", Age: 20, CompanyID: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+func TestMemoryView_FindMany(t *testing.T) {
+	view := TMemoryView(t)
+
+	users := new([]MemoryUser)
+	filter := &grest.Filter{Where: []interface{}{"age >= ? AND company_id IN (?)", 20, []int{1, 2}}, Order: "age desc, name", Offset: 1, Limit: 2}
+	count, err := view.FindMany(users, filter, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 4 || len(*users) != 2 {
+		t.Fatalf("unexpected count %d, users %+v", count, *users)
+	}
+	if (*users)[0].Name != "alice" || (*users)[1].Name != "bob" {
+		t.Fatalf("unexpected order %+v", *users)
+	}
+
+	ptrs := new([]*MemoryUser)
+	count, err = view.FindMany(ptrs, &grest.Filter{Where: []interface{}{map[string]interface{}{"name": "carol"}}, Fields: []string{"name"}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || (*ptrs)[0].Name != "carol" || (*ptrs)[0].Age != 0 {
+		t.Fatalf("unexpected result %+v", (*ptrs)[0])
+	}
+
+	// the offset is clamped
+	for offset, length := range map[int]int{-5: 2, 3: 1, 10: 0} {
+		if _, err := view.FindMany(users, &grest.Filter{Offset: offset, Limit: 2}, nil); err != nil || len(*users) != length {
+			t.Fatalf("unexpected users of offset %d: %+v, %v", offset, *users, err)
+		}
+	}
+}
+
+func TestMemoryView_SaveFindOneDelete(t *testing.T) {
+	view := TMemoryView(t)
+	cxt := &grest.Context{}
+
+	u := &MemoryUser{Name: "erin", Age: 50}
+	if err := view.Save(u, cxt); err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 5 {
+		t.Fatalf("unexpected id %d", u.ID)
+	}
+	u.Age = 51
+	if err := view.Save(u, cxt); err != nil {
+		t.Fatal(err)
+	}
+
+	cxt.ResourceID = "5"
+	found := new(MemoryUser)
+	if err := view.FindOne(found, cxt); err != nil {
+		t.Fatal(err)
+	}
+	if found.Age != 51 {
+		t.Fatalf("unexpected user %+v", found)
+	}
+
+	if err := view.Delete(&MemoryUser{ID: 5}, cxt); err != nil {
+		t.Fatal(err)
+	}
+	if err := view.FindOne(new(MemoryUser), cxt); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected record not found, got %v", err)
+	}
+
+	// write hooks are not supported
+	hooked := &grest.Context{WriteHooks: []grest.WriteHook{func(*gorm.DB, *grest.Change) error { return nil }}}
+	if err := view.Save(&MemoryUser{Name: "frank"}, hooked); err == nil {
+		t.Fatal("expected error of write hooks")
+	}
+	if err := view.Delete(&MemoryUser{ID: 1}, hooked); err == nil {
+		t.Fatal("expected error of write hooks")
+	}
+}
+
+func TestMatcher(t *testing.T) {
+	user := &MemoryUser{ID: 1, Name: "alice", Age: 30, CompanyID: 1}
+	cases := []struct {
+		where []interface{}
+		match bool
+	}{
+		{nil, true},
+		{[]interface{}{"name = 'alice'"}, true},
+		{[]interface{}{"name <> ?", "alice"}, false},
+		{[]interface{}{"age > ? OR name LIKE ?", 40, "AL%"}, true},
+		{[]interface{}{"NOT (age BETWEEN 10 AND 20)"}, true},
+		{[]interface{}{"company_id NOT IN (2, 3) AND name IS NOT NULL"}, true},
+		{[]interface{}{"companyId = ?", "1"}, true},
+		{[]interface{}{map[string]interface{}{"name": "bob"}}, false},
+	}
+	for _, c := range cases {
+		matcher, err := grest.NewMatcher(c.where)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matcher.Match(user) != c.match {
+			t.Fatalf("where %v expected %v", c.where, c.match)
+		}
+	}
+
+	if _, err := grest.NewMatcher([]interface{}{"name = ? AND age = ?", "alice"}); err == nil {
+		t.Fatal("expected error for missing argument")
+	}
+}
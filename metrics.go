@@ -0,0 +1,186 @@
+package grest
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// MetricsPath is default path of the metrics endpoint
+const MetricsPath = "/metrics"
+
+// Metrics is Prometheus metrics of resource requests and db queries
+//
+//	metrics := grest.NewMetrics(nil)
+//	metrics.Instrument(db)
+//	api.Container.Filter(metrics.Filter)
+//	api.AddMetricsService(metrics)
+type Metrics struct {
+	Registry *prometheus.Registry
+	// Requests is grest_requests_total by resource, action, method and status
+	Requests *prometheus.CounterVec
+	// Errors is grest_request_errors_total of responses with status 4xx and 5xx
+	Errors *prometheus.CounterVec
+	// Latency is grest_request_duration_seconds by resource and action
+	Latency *prometheus.HistogramVec
+	// Queries is grest_db_query_duration_seconds by resource and operation
+	Queries *prometheus.HistogramVec
+	// Rows is grest_db_rows of rows returned or affected by resource and operation
+	Rows *prometheus.HistogramVec
+}
+
+// NewMetrics is create Metrics registered into registry, a new registry is created if it is nil
+func NewMetrics(registry *prometheus.Registry) *Metrics {
+	if registry == nil {
+		registry = prometheus.NewRegistry()
+	}
+	m := &Metrics{
+		Registry: registry,
+		Requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grest_requests_total",
+			Help: "Number of requests of resources.",
+		}, []string{"resource", "action", "method", "status"}),
+		Errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "grest_request_errors_total",
+			Help: "Number of requests of resources responded with an error status.",
+		}, []string{"resource", "action", "status"}),
+		Latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grest_request_duration_seconds",
+			Help:    "Latency of requests of resources.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"resource", "action"}),
+		Queries: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grest_db_query_duration_seconds",
+			Help:    "Duration of db queries.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"resource", "operation"}),
+		Rows: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grest_db_rows",
+			Help:    "Rows returned or affected by db queries.",
+			Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+		}, []string{"resource", "operation"}),
+	}
+	registry.MustRegister(m.Requests, m.Errors, m.Latency, m.Queries, m.Rows)
+	return m
+}
+
+// Filter is restful filter recording requests, use it as container filter or resource Middleware
+func (m *Metrics) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	start := time.Now()
+	chain.ProcessFilter(request, response)
+	route := selectedRoute(request)
+	if route == nil {
+		// dispatch error, its status is not known by the response
+		return
+	}
+	resource, action := routeLabels(route)
+	status := strconv.Itoa(response.StatusCode())
+	m.Requests.WithLabelValues(resource, action, request.Request.Method, status).Inc()
+	m.Latency.WithLabelValues(resource, action).Observe(time.Since(start).Seconds())
+	if response.StatusCode() >= http.StatusBadRequest {
+		m.Errors.WithLabelValues(resource, action, status).Inc()
+	}
+}
+
+// Instrument record durations and rows of queries of the db
+func (m *Metrics) Instrument(db *gorm.DB) {
+	registerCallbacks(db, "grest:metrics", nil, func(scope *gorm.Scope, operation string, start time.Time) {
+		resource := scopeResource(scope)
+		m.Queries.WithLabelValues(resource, operation).Observe(time.Since(start).Seconds())
+		m.Rows.WithLabelValues(resource, operation).Observe(float64(scope.DB().RowsAffected))
+	})
+}
+
+// Handler is http handler of the metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// AddMetricsService serve the metrics at path of the container, default is MetricsPath,
+// it fails if the path is registered in the container
+func (api *API) AddMetricsService(m *Metrics, path ...string) (err error) {
+	p := MetricsPath
+	if len(path) > 0 && path[0] != "" {
+		p = path[0]
+	}
+	if err := api.checkPath(p); err != nil {
+		return err
+	}
+	// ServeMux panics on a registered pattern
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("path %s is registered in the container: %v", p, r)
+		}
+	}()
+	api.Container.Handle(p, m.Handler())
+	return nil
+}
+
+// selectedRoute is route of the request, nil if restful runs container filters after a dispatch error,
+// SelectedRoute and SelectedRoutePath dereference the unset route then, so the field is checked first
+func selectedRoute(request *restful.Request) restful.RouteReader {
+	if field := reflect.ValueOf(request).Elem().FieldByName("selectedRoute"); !field.IsValid() || field.IsNil() {
+		return nil
+	}
+	return request.SelectedRoute()
+}
+
+// routeLabels is resource and action of the route
+func routeLabels(route restful.RouteReader) (resource string, action string) {
+	metadata := route.Metadata()
+	resource, _ = metadata[KeyResource].(string)
+	if a, ok := metadata[KeyAction].(Action); ok {
+		action = string(a)
+	}
+	if action == "" {
+		action = route.Operation()
+	}
+	return resource, action
+}
+
+// scopeResource is model name of the query, or its table without a model
+func scopeResource(scope *gorm.Scope) string {
+	if scope.Value != nil {
+		if name := scope.GetModelStruct().ModelType; name != nil {
+			return name.Name()
+		}
+	}
+	return scope.TableName()
+}
+
+// registerCallbacks register callbacks around create, query, update, delete and row query of the db
+// before run before the operation, after run after it with the start time
+func registerCallbacks(db *gorm.DB, name string, before func(scope *gorm.Scope, operation string), after func(scope *gorm.Scope, operation string, start time.Time)) {
+	startKey := name + ":start"
+	// every registration needs its own processor, Register keeps the processor
+	register := func(operation string, processor func() *gorm.CallbackProcessor, first, last string) {
+		processor().Before(first).Register(name+":before_"+operation, func(scope *gorm.Scope) {
+			scope.InstanceSet(startKey, time.Now())
+			if before != nil {
+				before(scope, operation)
+			}
+		})
+		processor().After(last).Register(name+":after_"+operation, func(scope *gorm.Scope) {
+			start, ok := scope.InstanceGet(startKey)
+			if !ok {
+				return
+			}
+			if after != nil {
+				after(scope, operation, start.(time.Time))
+			}
+		})
+	}
+	callback := db.Callback()
+	register("create", callback.Create, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction")
+	register("query", callback.Query, "gorm:query", "gorm:after_query")
+	register("update", callback.Update, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction")
+	register("delete", callback.Delete, "gorm:begin_transaction", "gorm:commit_or_rollback_transaction")
+	register("row_query", callback.RowQuery, "gorm:row_query", "gorm:row_query")
+}
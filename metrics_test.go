@@ -0,0 +1,62 @@
+package grest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestMetricsAndAccessLog(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	metrics := grest.NewMetrics(nil)
+	metrics.Instrument(h.DB)
+	logs := new(bytes.Buffer)
+	h.Container.Filter(metrics.Filter)
+	h.Container.Filter(grest.NewAccessLog(logs).Filter)
+	auth := grest.NewAuth(false, &grest.APIKeyAuth{Store: grest.APIKeys{"k1": {ID: "u1", Tenant: "t1"}}})
+	h.AddResource(&Doc{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{auth.Filter}})
+	if err := h.API.AddMetricsService(metrics); err != nil {
+		t.Fatal(err)
+	}
+
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Header(grest.APIKeyHeader, "k1").Filter(&grest.Filter{Fields: []string{"title", "id"}}).Expect().Status(http.StatusOK)
+	h.GET("/doc/9").Expect().Status(http.StatusNotFound)
+	// container filters run without a route on dispatch errors
+	h.GET("/unknown").Expect().Status(http.StatusNotFound)
+
+	body := string(h.GET("/metrics").Expect().Status(http.StatusOK).Body())
+	for _, metric := range []string{
+		`grest_requests_total{action="list",method="GET",resource="Doc",status="200"} 1`,
+		`grest_requests_total{action="create",method="POST",resource="Doc",status="200"} 1`,
+		`grest_request_errors_total{action="read",resource="Doc",status="404"} 1`,
+		`grest_request_duration_seconds_count{action="list",resource="Doc"} 1`,
+		`grest_db_query_duration_seconds_count{operation="create",resource="Doc"} 1`,
+		`grest_db_query_duration_seconds_count{operation="row_query",resource="Doc"} 1`,
+		`grest_db_rows_sum{operation="create",resource="Doc"} 1`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected metric %s, got %s", metric, body)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected access logs %s", logs)
+	}
+	entry := grest.AccessEntry{}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Resource != "Doc" || entry.Action != "list" || entry.Status != http.StatusOK || entry.Principal != "u1" ||
+		entry.Tenant != "t1" || entry.Filter == nil || entry.Filter.Fields[0] != "id" {
+		t.Fatalf("unexpected access log %s", lines[1])
+	}
+}
@@ -0,0 +1,269 @@
+package grest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/go-openapi/spec"
+	"github.com/jinzhu/gorm"
+)
+
+// KeyFilterModel is route metadata key of the model queried by the filter parameter
+const KeyFilterModel = "grest.filter.model"
+
+// Security definitions of routes requiring scopes, the scopes are listed in x-scopes of the operation
+const (
+	SecurityBearer = "bearer"
+	SecurityAPIKey = "apiKey"
+)
+
+// KeyOpenAPIScopes is operation extension of the required scopes
+const KeyOpenAPIScopes = "x-scopes"
+
+// OpenAPIPath is default path of the aggregated OpenAPI spec
+const OpenAPIPath = "/openapi.json"
+
+// OpenAPIService create web service serving one OpenAPI spec for every web service registered in the container
+// the spec is rebuilt when web services or routes of the container change, e.g. by API.AddResource
+func OpenAPIService(container *restful.Container, config restfulspec.Config) *restful.WebService {
+	if config.APIPath == "" {
+		config.APIPath = OpenAPIPath
+	}
+	ws := new(restful.WebService)
+	ws.Path(config.APIPath).Produces(restful.MIME_JSON)
+
+	var (
+		mu      sync.Mutex
+		built   []builtService
+		swagger *spec.Swagger
+	)
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		cfg := config
+		cfg.WebServices = nil
+		services := make([]builtService, 0)
+		for _, each := range container.RegisteredWebServices() {
+			if each != ws {
+				cfg.WebServices = append(cfg.WebServices, each)
+				services = append(services, builtService{each, len(each.Routes())})
+			}
+		}
+
+		mu.Lock()
+		if swagger == nil || !equalServices(built, services) {
+			postBuild := config.PostBuildSwaggerObjectHandler
+			cfg.PostBuildSwaggerObjectHandler = func(s *spec.Swagger) {
+				EnrichSwagger(s, cfg.WebServices...)
+				if postBuild != nil {
+					postBuild(s)
+				}
+			}
+			swagger = restfulspec.BuildSwagger(cfg)
+			built = services
+		}
+		current := swagger
+		mu.Unlock()
+		response.WriteAsJson(current)
+	}).Doc("OpenAPI spec of all resources"))
+	return ws
+}
+
+// builtService is web service and its route count the spec is built with
+type builtService struct {
+	ws     *restful.WebService
+	routes int
+}
+
+// equalServices is whether the specs are built with the same services
+func equalServices(a, b []builtService) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// EnrichSwagger add what restfulspec can not derive from routes:
+// filter schemas of the models and response headers
+func EnrichSwagger(s *spec.Swagger, services ...*restful.WebService) {
+	if s.Definitions == nil {
+		s.Definitions = spec.Definitions{}
+	}
+	for _, ws := range services {
+		for _, route := range ws.Routes() {
+			operation := swaggerOperation(s, route)
+			if operation == nil {
+				continue
+			}
+
+			for code, re := range route.ResponseErrors {
+				if len(re.Headers) == 0 || operation.Responses == nil {
+					continue
+				}
+				resp := operation.Responses.StatusCodeResponses[code]
+				for name, header := range re.Headers {
+					h := spec.ResponseHeader().WithDescription(header.Description)
+					if header.Items != nil {
+						h.Typed(header.Type, header.Format)
+					}
+					resp.AddHeader(name, h)
+				}
+				operation.Responses.StatusCodeResponses[code] = resp
+			}
+
+			if scopes, ok := route.Metadata[KeyScopes].([]string); ok && len(scopes) > 0 {
+				securityDefinitions(s)
+				operation.SecuredWith(SecurityBearer).SecuredWith(SecurityAPIKey)
+				operation.AddExtension(KeyOpenAPIScopes, scopes)
+			}
+
+			model, ok := route.Metadata[KeyFilterModel]
+			if !ok {
+				continue
+			}
+			name := ModelType(model).Name() + "Filter"
+			s.Definitions[name] = FilterSchema(model)
+			for i, param := range operation.Parameters {
+				if param.In == "query" && param.Name == "filter" {
+					operation.Parameters[i].AddExtension("x-schema", map[string]string{"$ref": "#/definitions/" + name})
+				}
+			}
+		}
+	}
+}
+
+// securityDefinitions add SecurityBearer and SecurityAPIKey definitions, see JWTAuth and APIKeyAuth
+func securityDefinitions(s *spec.Swagger) {
+	if s.SecurityDefinitions == nil {
+		s.SecurityDefinitions = spec.SecurityDefinitions{}
+	}
+	if _, ok := s.SecurityDefinitions[SecurityBearer]; !ok {
+		scheme := spec.APIKeyAuth("Authorization", "header")
+		scheme.Description = "JWT bearer token, e.g. Bearer <token>"
+		s.SecurityDefinitions[SecurityBearer] = scheme
+	}
+	if _, ok := s.SecurityDefinitions[SecurityAPIKey]; !ok {
+		scheme := spec.APIKeyAuth(APIKeyHeader, "header")
+		scheme.Description = "API key"
+		s.SecurityDefinitions[SecurityAPIKey] = scheme
+	}
+}
+
+// swaggerOperation find the operation built for the route
+func swaggerOperation(s *spec.Swagger, route restful.Route) *spec.Operation {
+	if s.Paths == nil {
+		return nil
+	}
+	item, ok := s.Paths.Paths[swaggerPath(route.Path)]
+	if !ok {
+		return nil
+	}
+	switch route.Method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodPost:
+		return item.Post
+	case http.MethodPut:
+		return item.Put
+	case http.MethodPatch:
+		return item.Patch
+	case http.MethodDelete:
+		return item.Delete
+	case http.MethodHead:
+		return item.Head
+	case http.MethodOptions:
+		return item.Options
+	}
+	return nil
+}
+
+// swaggerPath convert route path to spec path the way restfulspec does
+// e.g. "/user/" -> "/user", "/user/{id:[0-9]+}" -> "/user/{id}"
+func swaggerPath(routePath string) string {
+	result := ""
+	for _, fragment := range strings.Split(routePath, "/") {
+		if fragment == "" {
+			continue
+		}
+		if strings.HasPrefix(fragment, "{") && strings.Contains(fragment, ":") {
+			fragment = fragment[:strings.Index(fragment, ":")] + "}"
+		}
+		result += "/" + fragment
+	}
+	return result
+}
+
+// FilterSchema is JSON schema of the Filter for the model
+// fields, order and where refer to database columns, preloads refer to relations
+func FilterSchema(value interface{}) spec.Schema {
+	columns, relations := modelColumns(value)
+
+	columnEnum := make([]interface{}, 0, len(columns))
+	for _, column := range columns {
+		columnEnum = append(columnEnum, column)
+	}
+	relationEnum := make([]interface{}, 0, len(relations))
+	for _, relation := range relations {
+		relationEnum = append(relationEnum, relation)
+	}
+
+	columnItems := spec.StringProperty()
+	if len(columnEnum) > 0 {
+		columnItems.WithEnum(columnEnum...)
+	}
+	relationItems := spec.StringProperty()
+	if len(relationEnum) > 0 {
+		relationItems.WithEnum(relationEnum...)
+	}
+
+	schema := new(spec.Schema).Typed("object", "").
+		WithDescription(fmt.Sprintf("query filter of %s, must be JSON-encoded", ModelType(value).Name()))
+	schema.SetProperty("withCount", *spec.BoolProperty().WithDescription("whether return total count"))
+	schema.SetProperty("fields", *spec.ArrayProperty(columnItems).WithDescription("returned columns"))
+	schema.SetProperty("preloads", *spec.ArrayProperty(relationItems).WithDescription("returned relations"))
+	schema.SetProperty("where", *spec.ArrayProperty(nil).
+		WithDescription(`query condition, the first element is the condition and the rest are its arguments, e.g. ["name = ? AND age > ?", "grest", 18]`).
+		WithMinItems(1))
+	schema.SetProperty("order", *spec.StringProperty().
+		WithDescription(fmt.Sprintf("sort columns, e.g. \"%s desc\", columns: %s", firstOr(columns, "id"), strings.Join(columns, ", "))))
+	schema.SetProperty("offset", *spec.Int64Property().WithMinimum(0, false).WithDescription("skip data"))
+	schema.SetProperty("limit", *spec.Int64Property().WithMinimum(0, false).WithDescription("query data length, 0 is unlimited"))
+	schema.SetProperty("joins", *spec.ArrayProperty(spec.StringProperty()).WithDescription("join clauses"))
+	schema.SetProperty("groups", *spec.ArrayProperty(spec.StringProperty()).WithDescription("group columns"))
+	schema.SetProperty("asOf", *spec.DateTimeProperty().WithDescription("query the state at the time, only for resources keeping history"))
+	return *schema
+}
+
+// modelColumns return database columns and relation names of the model
+func modelColumns(value interface{}) (columns []string, relations []string) {
+	scope := gorm.Scope{Value: value}
+	for _, field := range scope.GetModelStruct().StructFields {
+		if field.IsIgnored {
+			continue
+		}
+		if field.Relationship != nil {
+			relations = append(relations, field.Name)
+			continue
+		}
+		if field.IsNormal {
+			columns = append(columns, field.DBName)
+		}
+	}
+	sort.Strings(relations)
+	return columns, relations
+}
+
+func firstOr(strs []string, def string) string {
+	if len(strs) > 0 {
+		return strs[0]
+	}
+	return def
+}
@@ -0,0 +1,105 @@
+package grest_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/go-openapi/spec"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestFilterSchema(t *testing.T) {
+	schema := grest.FilterSchema(&Company{})
+	fields := schema.Properties["fields"].Items.Schema
+	if len(fields.Enum) != 2 || fields.Enum[0] != "id" || fields.Enum[1] != "company_name" {
+		t.Fatalf("unexpected fields enum %v", fields.Enum)
+	}
+	preloads := schema.Properties["preloads"].Items.Schema
+	if len(preloads.Enum) != 1 || preloads.Enum[0] != "Users" {
+		t.Fatalf("unexpected preloads enum %v", preloads.Enum)
+	}
+	for _, name := range []string{"withCount", "where", "order", "offset", "limit", "joins", "groups", "asOf"} {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Fatalf("expected property %s", name)
+		}
+	}
+}
+
+func TestEnrichSwagger(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	res := h.AddResource(&Doc{}, grest.ResourceConfig{Scopes: map[grest.Action][]string{grest.ActionCreate: {"doc:write"}}})
+
+	swagger := restfulspec.BuildSwagger(restfulspec.Config{
+		WebServices: []*restful.WebService{res.View.WS},
+		PostBuildSwaggerObjectHandler: func(s *spec.Swagger) {
+			grest.EnrichSwagger(s, res.View.WS)
+		},
+	})
+	if _, ok := swagger.Definitions["DocFilter"]; !ok {
+		t.Fatal("expected definition DocFilter")
+	}
+	list := swagger.Paths.Paths["/doc"].Get
+	if list == nil {
+		t.Fatal("expected operation GET /doc")
+	}
+	var schemaRef bool
+	for _, param := range list.Parameters {
+		if param.Name == "filter" {
+			ref, ok := param.Extensions["x-schema"].(map[string]string)
+			schemaRef = ok && ref["$ref"] == "#/definitions/DocFilter"
+		}
+	}
+	if !schemaRef {
+		t.Fatalf("expected x-schema of filter parameter %+v", list.Parameters)
+	}
+	if _, ok := list.Responses.StatusCodeResponses[http.StatusOK].Headers["count"]; !ok {
+		t.Fatal("expected count header of GET /doc")
+	}
+	if len(swagger.Paths.Paths["/doc"].Post.Security) != 2 {
+		t.Fatalf("expected security of POST /doc %+v", swagger.Paths.Paths["/doc"].Post.Security)
+	}
+
+	// GET /{id}
+	byID := swagger.Paths.Paths["/doc/{id}"].Get
+	if byID == nil {
+		t.Fatal("expected operation GET /doc/{id}")
+	}
+	if _, ok := byID.Responses.StatusCodeResponses[http.StatusNotFound]; !ok {
+		t.Fatal("expected 404 response of GET /doc/{id}")
+	}
+}
+
+func TestOpenAPIService(t *testing.T) {
+	h := gresttest.New(t, &Doc{})
+	defer h.Close()
+	h.Container.Add(grest.OpenAPIService(h.Container, restfulspec.Config{}))
+	h.POST("/doc").JSON(&Doc{Title: "t"}).Expect().Status(http.StatusOK)
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Contains(`"t"`)
+	h.GET("/doc/9").Expect().Status(http.StatusNotFound)
+
+	paths := func() map[string]interface{} {
+		swagger := struct {
+			Paths map[string]interface{} `json:"paths"`
+		}{}
+		if err := json.Unmarshal(h.GET(grest.OpenAPIPath).Expect().Status(http.StatusOK).Body(), &swagger); err != nil {
+			t.Fatal(err)
+		}
+		return swagger.Paths
+	}
+	if _, ok := paths()["/doc/{id}"]; !ok {
+		t.Fatal("expected path /doc/{id}")
+	}
+	if _, ok := paths()["/note"]; ok {
+		t.Fatal("unexpected path /note")
+	}
+	// the spec is rebuilt after a resource is added
+	h.AddResource(&Note{})
+	if _, ok := paths()["/note"]; !ok {
+		t.Fatal("expected path /note after AddResource")
+	}
+}
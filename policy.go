@@ -0,0 +1,420 @@
+package grest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// RoleAnonymous is role of the request without principal
+const RoleAnonymous = "anonymous"
+
+var (
+	errForbidden   = errors.New("forbidden")
+	errOutOfScope  = errors.New("data is out of scope")
+	errUnauthorize = errors.New("unauthorized")
+)
+
+// Principal is the authenticated caller
+type Principal struct {
+	ID     string   `json:"id"`
+	Roles  []string `json:"roles"`
+	Tenant string   `json:"tenant,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// HasRole is whether the principal has the role
+func (p *Principal) HasRole(role string) bool {
+	return p != nil && containsString(p.Roles, role)
+}
+
+// HasScope is whether the principal is granted the scope
+func (p *Principal) HasScope(scope string) bool {
+	return p != nil && containsString(p.Scopes, scope)
+}
+
+// Decision is result of Policy
+type Decision struct {
+	// Deny reject the request, 401 without principal, 403 otherwise
+	Deny bool
+	// Where scope the rows, e.g. []interface{}{"owner_id = ?", 1}
+	// it is added to queries, and written data must match it
+	Where []interface{}
+	// Mask are fields reset to zero value in responses
+	Mask []string
+	// Forbid are fields can not be written, stored values are kept on update
+	Forbid []string
+}
+
+// Policy decide whether the action is allowed on the model of the context
+type Policy interface {
+	Evaluate(cxt *Context, action Action, value interface{}) (*Decision, error)
+}
+
+// MaskPolicy is Policy telling fields masked for any caller, they are reset in payloads of change events,
+// e.g. events delivered by Webhooks and EventBus
+type MaskPolicy interface {
+	Masks(value interface{}) []string
+}
+
+// PolicyFunc is function Policy
+type PolicyFunc func(cxt *Context, action Action, value interface{}) (*Decision, error)
+
+// Evaluate call the function
+func (f PolicyFunc) Evaluate(cxt *Context, action Action, value interface{}) (*Decision, error) {
+	return f(cxt, action, value)
+}
+
+// Permission is permission of a role
+type Permission struct {
+	// Resource is model name or url path, "*" is all resources
+	Resource string
+	// Actions are allowed actions, empty is all
+	Actions []Action
+	// Where scope the rows, e.g. rows owned by the principal
+	Where  func(cxt *Context) []interface{}
+	Mask   []string
+	Forbid []string
+}
+
+// match is whether the permission is granted on the resource and action
+func (p *Permission) match(name string, action Action) bool {
+	if p.Resource != "*" && p.Resource != name && p.Resource != ToParamString(name) {
+		return false
+	}
+	if len(p.Actions) == 0 {
+		return true
+	}
+	for _, a := range p.Actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// RolePolicy is role to permissions table, RoleAnonymous is used without principal
+// roles of the principal are checked in order, the first matching permission is used
+//
+//	policy := grest.RolePolicy{
+//	    "admin":  {{Resource: "*"}},
+//	    "viewer": {{Resource: "User", Actions: []grest.Action{grest.ActionList, grest.ActionRead}, Mask: []string{"password"}}},
+//	}
+type RolePolicy map[string][]Permission
+
+// Masks are fields masked by any permission reading the model
+func (r RolePolicy) Masks(value interface{}) []string {
+	name := ModelType(value).Name()
+	var masks []string
+	for _, permissions := range r {
+		for i := range permissions {
+			permission := &permissions[i]
+			if !permission.match(name, ActionRead) && !permission.match(name, ActionList) {
+				continue
+			}
+			for _, mask := range permission.Mask {
+				if !containsString(masks, mask) {
+					masks = append(masks, mask)
+				}
+			}
+		}
+	}
+	return masks
+}
+
+// Evaluate deny the action without permission
+func (r RolePolicy) Evaluate(cxt *Context, action Action, value interface{}) (*Decision, error) {
+	roles := []string{RoleAnonymous}
+	if cxt.Principal != nil {
+		roles = cxt.Principal.Roles
+	}
+	name := ModelType(value).Name()
+	for _, role := range roles {
+		for i := range r[role] {
+			permission := &r[role][i]
+			if !permission.match(name, action) {
+				continue
+			}
+			decision := &Decision{Mask: permission.Mask, Forbid: permission.Forbid}
+			if permission.Where != nil {
+				decision.Where = permission.Where(cxt)
+			}
+			return decision, nil
+		}
+	}
+	return &Decision{Deny: true}, nil
+}
+
+// authorize check required scopes and evaluate the policy of the action, row scope of the decision is added into the context
+// the result is not nil if the request is rejected
+func (g *GenericAPIView) authorize(cxt *Context, action Action) (*Decision, *Result) {
+	for _, scope := range g.Scopes[action] {
+		if cxt.Principal == nil {
+			return nil, errorResult(http.StatusUnauthorized, "authorize", errUnauthorize)
+		}
+		if !cxt.Principal.HasScope(scope) {
+			return nil, errorResult(http.StatusForbidden, "authorize", errMissingScope)
+		}
+	}
+	if g.Policy == nil {
+		return &Decision{}, nil
+	}
+	decision, err := g.Policy.Evaluate(cxt, action, g.Value)
+	if err != nil {
+		return nil, errorResult(http.StatusInternalServerError, "authorize", err)
+	}
+	if decision == nil {
+		return &Decision{}, nil
+	}
+	if decision.Deny {
+		if cxt.Principal == nil {
+			return nil, errorResult(http.StatusUnauthorized, "authorize", errUnauthorize)
+		}
+		return nil, errorResult(http.StatusForbidden, "authorize", errForbidden)
+	}
+	if len(decision.Where) > 0 {
+		scopes := cxt.RowScopes
+		cxt.RowScopes = append(scopes[:len(scopes):len(scopes)], decision.Where)
+	}
+	mask := cxt.Mask[:len(cxt.Mask):len(cxt.Mask)]
+	if masker, ok := g.Policy.(MaskPolicy); ok {
+		mask = append(mask, masker.Masks(g.Value)...)
+	}
+	cxt.Mask = append(mask, decision.Mask...)
+	return decision, nil
+}
+
+// guardWrite check data written by the request against the decision
+// forbidden fields must be blank on create, and keep stored values on update
+func (g *GenericAPIView) guardWrite(cxt *Context, result interface{}, action Action, decision *Decision) error {
+	if len(decision.Where) > 0 {
+		matcher, err := NewMatcher(decision.Where)
+		if err != nil {
+			// the row scope can not be checked, the write is out of scope
+			return NewHTTPError(http.StatusForbidden, fmt.Errorf("%v: %v", errOutOfScope, err))
+		}
+		if !matcher.Match(result) {
+			return NewHTTPError(http.StatusForbidden, errOutOfScope)
+		}
+	}
+	if len(decision.Forbid) == 0 {
+		return nil
+	}
+
+	scope := gorm.Scope{Value: result}
+	var stored *gorm.Scope
+	if action == ActionUpdate {
+		current := g.newOne()
+		if err := g.findStored(current, cxt, fmt.Sprint(scope.PrimaryField().Field.Interface())); err != nil && err != gorm.ErrRecordNotFound {
+			return err
+		} else if err == nil {
+			stored = &gorm.Scope{Value: current}
+		}
+	}
+	for _, name := range decision.Forbid {
+		field, ok := lookupField(&scope, name)
+		if !ok {
+			continue
+		}
+		if stored == nil {
+			if !field.IsBlank {
+				return NewHTTPError(http.StatusForbidden, fmt.Errorf("field %s is forbidden", name))
+			}
+			continue
+		}
+		storedField, _ := lookupField(stored, name)
+		if !field.IsBlank && !reflect.DeepEqual(field.Field.Interface(), storedField.Field.Interface()) {
+			return NewHTTPError(http.StatusForbidden, fmt.Errorf("field %s is forbidden", name))
+		}
+		field.Field.Set(storedField.Field)
+	}
+	return nil
+}
+
+// findStored query the stored row of a write past the cache, fields without JSON are not restored from the cache
+func (g *GenericAPIView) findStored(result interface{}, cxt *Context, id string) error {
+	readCxt := cxt.Clone()
+	readCxt.ResourceID = id
+	readCxt.noCache = true
+	return g.FindOne(result, readCxt)
+}
+
+// checkMask reject the filter referencing masked fields, masked values can not be read through where, order or fields
+func checkMask(value interface{}, filter *Filter, mask []string) error {
+	if len(mask) == 0 || filter == nil {
+		return nil
+	}
+	scope := gorm.Scope{Value: reflect.New(ModelType(value)).Interface()}
+	masked := map[string]string{}
+	for _, name := range mask {
+		names := []string{name}
+		if field, ok := lookupField(&scope, name); ok {
+			names = append(names, field.Name, field.DBName, strings.Split(GetStructTagJSON(field), ",")[0])
+		}
+		for _, n := range names {
+			if n != "" && n != "-" {
+				masked[strings.ToLower(n)] = name
+			}
+		}
+	}
+	// fields and joins may hide the column in aliases, expressions or join conditions
+	var refs []string
+	for _, field := range filter.Fields {
+		refs = append(refs, sqlIdentifiers(field)...)
+	}
+	for _, join := range filter.Joins {
+		refs = append(refs, sqlIdentifiers(join)...)
+	}
+	refs = append(refs, sqlIdentifiers(filter.Order)...)
+	for _, group := range filter.Groups {
+		refs = append(refs, sqlIdentifiers(group)...)
+	}
+	if len(filter.Where) > 0 {
+		switch cond := filter.Where[0].(type) {
+		case string:
+			refs = append(refs, sqlIdentifiers(cond)...)
+		case map[string]interface{}:
+			for key := range cond {
+				refs = append(refs, key)
+			}
+		}
+	}
+	for _, ref := range refs {
+		// the column may be qualified by its table
+		parts := strings.Split(strings.Trim(ref, "`\""), ".")
+		if name, ok := masked[strings.ToLower(strings.Trim(parts[len(parts)-1], "`\""))]; ok {
+			return NewHTTPError(http.StatusForbidden, fmt.Errorf("field %s is masked", name))
+		}
+	}
+	return nil
+}
+
+// sqlIdentifiers is words of the raw SQL out of string literals, quoted identifiers are included
+func sqlIdentifiers(raw string) []string {
+	var words []string
+	start := -1
+	var quote byte
+	for i := 0; i <= len(raw); i++ {
+		var c byte
+		if i < len(raw) {
+			c = raw[i]
+		}
+		if quote == '\'' {
+			if c == '\'' || c == 0 {
+				quote = 0
+			}
+			continue
+		}
+		if c == '\'' {
+			quote = c
+		}
+		word := c == '_' || c == '.' || c == '`' || c == '"' || (c >= '0' && c <= '9') || (c|0x20 >= 'a' && c|0x20 <= 'z')
+		if word && start < 0 {
+			start = i
+		} else if !word && start >= 0 {
+			words = append(words, raw[start:i])
+			start = -1
+		}
+	}
+	return words
+}
+
+// maskFields reset the fields of struct or slice pointer to zero value
+func maskFields(value interface{}, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	rv := Indirect(reflect.ValueOf(value))
+	if rv.Kind() == reflect.Slice {
+		for i := 0; i < rv.Len(); i++ {
+			item := rv.Index(i)
+			if item.Kind() != reflect.Ptr {
+				item = item.Addr()
+			}
+			maskFields(item.Interface(), names)
+		}
+		return
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	scope := gorm.Scope{Value: value}
+	for _, name := range names {
+		if field, ok := lookupField(&scope, name); ok {
+			field.Field.Set(reflect.Zero(field.Field.Type()))
+		}
+	}
+}
+
+// lookupField find field by struct name, column or json name
+func lookupField(scope *gorm.Scope, name string) (*gorm.Field, bool) {
+	if field, ok := scope.FieldByName(name); ok {
+		return field, true
+	}
+	for _, field := range scope.Fields() {
+		if strings.Split(GetStructTagJSON(field), ",")[0] == name {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+// applyScopes add tenant and row scopes of the context into db
+func applyScopes(db *gorm.DB, value interface{}, context *Context) *gorm.DB {
+	db = scopeTenant(db, value, context)
+	if context == nil {
+		return db
+	}
+	for _, where := range context.RowScopes {
+		if len(where) > 0 {
+			db = db.Where(where[0], where[1:]...)
+		}
+	}
+	return db
+}
+
+// checkScope reject updating the row out of tenant or row scopes, the row is reported as not found
+func checkScope(db *gorm.DB, value interface{}, context *Context) error {
+	if !context.Scoped() {
+		return nil
+	}
+	total := 0
+	if err := db.Unscoped().Model(value).Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	scoped := 0
+	if err := applyScopes(db.Unscoped().Model(value), value, context).Count(&scoped).Error; err != nil {
+		return err
+	}
+	if scoped == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// matchScopes is whether the value is in tenant and row scopes of the context
+func matchScopes(value interface{}, context *Context) (bool, error) {
+	if !matchTenant(value, context) {
+		return false, nil
+	}
+	if context == nil {
+		return true, nil
+	}
+	for _, where := range context.RowScopes {
+		matcher, err := NewMatcher(where)
+		if err != nil {
+			return false, err
+		}
+		if !matcher.Match(value) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package grest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type Doc struct {
+	ID      uint   `json:"id" gorm:"primary_key"`
+	OwnerID string `json:"ownerId"`
+	Title   string `json:"title"`
+	Secret  string `json:"secret"`
+}
+
+func TestRolePolicy(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	principal := func(cxt *grest.Context) error {
+		if id := cxt.Request.HeaderParameter("X-User"); id != "" {
+			cxt.Principal = &grest.Principal{ID: id, Roles: []string{cxt.Request.HeaderParameter("X-Role")}}
+		}
+		return nil
+	}
+	policy := grest.RolePolicy{
+		"reader": {{Resource: "doc", Actions: []grest.Action{grest.ActionList, grest.ActionRead}, Mask: []string{"secret"}}},
+		"writer": {{
+			Resource: "Doc",
+			Where: func(cxt *grest.Context) []interface{} {
+				return []interface{}{"owner_id = ?", cxt.Principal.ID}
+			},
+			Forbid: []string{"secret"},
+		}},
+	}
+	var events []*grest.Event
+	bus := grest.NewEventBus()
+	bus.Subscribe(func(event *grest.Event) { events = append(events, event) })
+	h.API.Context.CommitHooks = []grest.CommitHook{bus.Hook()}
+	h.AddResource(&Doc{}, grest.ResourceConfig{Hooks: []grest.ContextHook{principal}, Policy: policy})
+	h.DB.Create(&Doc{OwnerID: "w1", Title: "seed", Secret: "s"})
+
+	writer := func(r *gresttest.Request, id string) *gresttest.Request {
+		return r.Header("X-User", id).Header("X-Role", "writer")
+	}
+	h.GET("/doc").Expect().Status(http.StatusUnauthorized)
+	writer(h.POST("/doc"), "w1").JSON(&Doc{OwnerID: "w1", Title: "t"}).Expect().Status(http.StatusOK)
+	writer(h.POST("/doc"), "w1").JSON(&Doc{OwnerID: "w2", Title: "t"}).Expect().Status(http.StatusForbidden)
+	writer(h.POST("/doc"), "w1").JSON(&Doc{OwnerID: "w1", Secret: "x"}).Expect().Status(http.StatusForbidden)
+	writer(h.GET("/doc"), "w2").Expect().Status(http.StatusOK).Count(0)
+	writer(h.PUT("/doc"), "w2").JSON(&Doc{ID: 1, OwnerID: "w2"}).Expect().Status(http.StatusNotFound)
+	writer(h.PUT("/doc"), "w1").JSON(&Doc{ID: 1, OwnerID: "w1", Title: "renamed"}).Expect().Status(http.StatusOK)
+
+	var docs []Doc
+	h.GET("/doc").Header("X-User", "r").Header("X-Role", "reader").Expect().Status(http.StatusOK).Count(2).JSON(&docs)
+	if docs[0].Secret != "" || docs[0].Title != "renamed" {
+		t.Fatalf("unexpected docs %+v", docs)
+	}
+	stored := new(Doc)
+	h.DB.First(stored, 1)
+	if stored.Secret != "s" {
+		t.Fatalf("forbidden field is overwritten %+v", stored)
+	}
+	// fields masked for readers are not published
+	if len(events) != 2 || strings.Contains(string(events[1].Payload), `"s"`) || events[1].Diff["title"].After != "renamed" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+	h.DELETE("/doc").Header("X-User", "r").Header("X-Role", "reader").JSON(stored).Expect().Status(http.StatusForbidden)
+
+	// masked fields can not be read through the filter
+	reader := func() *gresttest.Request {
+		return h.GET("/doc").Header("X-User", "r").Header("X-Role", "reader")
+	}
+	for _, filter := range []*grest.Filter{
+		{Where: []interface{}{"secret = ?", "s"}},
+		{Where: []interface{}{"docs.\"secret\" > ?", "a"}},
+		{Where: []interface{}{map[string]interface{}{"secret": "s"}}},
+		{Order: "title, Secret desc"},
+		{Fields: []string{"id", "secret"}},
+		{Fields: []string{"id", "secret as title"}},
+		{Fields: []string{"id", "upper(secret) as title"}},
+		{Joins: []string{"join docs d2 on d2.secret = docs.title"}},
+	} {
+		reader().Filter(filter).Expect().Status(http.StatusForbidden)
+	}
+	reader().Filter(&grest.Filter{Where: []interface{}{"title = 'secret'"}}).Expect().Status(http.StatusOK).Count(0)
+
+	// the condition can not escape its group to OR with the row scope
+	writer(h.GET("/doc"), "w2").Filter(&grest.Filter{Where: []interface{}{"1=1) OR (1=1"}}).Expect().Status(http.StatusBadRequest)
+}
@@ -0,0 +1,242 @@
+package grest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+)
+
+// Headers of rate limiting
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRetryAfter         = "Retry-After"
+)
+
+// Costs of queries, see QueryCost
+const (
+	// CostUnbounded is extra cost of a query without limit
+	CostUnbounded = 10
+	// CostPageSize is number of rows of a query costing one more token
+	CostPageSize = 100
+)
+
+var errRateLimited = errors.New("rate limit exceeded")
+
+// Rate is token bucket of Limit tokens refilled every Period, Burst is capacity of the bucket, default is Limit
+type Rate struct {
+	Limit  int
+	Period time.Duration
+	Burst  int
+}
+
+// capacity is max tokens of the bucket
+func (r Rate) capacity() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return float64(r.Limit)
+}
+
+// perSecond is tokens refilled per second
+func (r Rate) perSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+// LimitResult is result of taking tokens
+type LimitResult struct {
+	Allowed bool
+	// Limit is capacity of the bucket, Remaining is tokens left
+	Limit     int
+	Remaining int
+	// Reset is time until the bucket is full, RetryAfter is time until the cost can be taken
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// LimitStore keep token buckets, implement it by a shared backend for multiple instances
+type LimitStore interface {
+	// Take take cost tokens of bucket of the key if there are enough tokens
+	Take(key string, rate Rate, cost int) (*LimitResult, error)
+}
+
+// MemoryLimitStore is LimitStore in memory
+type MemoryLimitStore struct {
+	// Now is clock of the store, default is time.Now
+	Now     func() time.Time
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	takes   int
+}
+
+// bucket is tokens of a key at last
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+// NewMemoryLimitStore is create MemoryLimitStore
+func NewMemoryLimitStore() *MemoryLimitStore {
+	return &MemoryLimitStore{Now: time.Now, buckets: map[string]*bucket{}}
+}
+
+// Take take cost tokens of bucket of the key, cost more than capacity of the rate is never allowed
+func (s *MemoryLimitStore) Take(key string, rate Rate, cost int) (*LimitResult, error) {
+	if rate.Limit <= 0 || rate.Period <= 0 {
+		return nil, errors.New("rate limit and period must be positive")
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+	capacity, perSecond := rate.capacity(), rate.perSecond()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buckets == nil {
+		s.buckets = map[string]*bucket{}
+	}
+	if s.takes++; s.takes%1024 == 0 {
+		s.sweep(now)
+	}
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, last: now}
+		s.buckets[key] = b
+	}
+	b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	need := float64(cost)
+	result := &LimitResult{Limit: int(capacity)}
+	if b.tokens >= need {
+		b.tokens -= need
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((math.Min(need, capacity) - b.tokens) / perSecond)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = seconds((capacity - b.tokens) / perSecond)
+	b.full = now.Add(result.Reset)
+	return result, nil
+}
+
+// sweep drop full buckets, they are the same as new buckets
+func (s *MemoryLimitStore) sweep(now time.Time) {
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// seconds is duration of the seconds
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// RateLimit is token bucket rate limiting of requests by principal or client IP, per resource and action,
+// a query costing more than capacity of the rate gets 400
+//
+//	limit := grest.NewRateLimit(grest.Rate{Limit: 100, Period: time.Minute})
+//	limit.Rates = map[grest.Action]grest.Rate{grest.ActionList: {Limit: 20, Period: time.Minute}}
+//	api.AddResource(&User{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{auth.Filter, limit.Filter}})
+type RateLimit struct {
+	Store LimitStore
+	// Rate is default rate of actions, Rates are rates of actions having their own buckets
+	Rate  Rate
+	Rates map[Action]Rate
+	// Key is identity of the request, default is RateLimitKey
+	Key func(request *restful.Request) string
+	// Cost is tokens of a list query, default is QueryCost, other actions cost one token
+	Cost func(filter *Filter) int
+}
+
+// NewRateLimit is create RateLimit of the rate with MemoryLimitStore
+func NewRateLimit(rate Rate) *RateLimit {
+	return &RateLimit{Store: NewMemoryLimitStore(), Rate: rate, Key: RateLimitKey, Cost: QueryCost}
+}
+
+// Filter is restful filter limiting requests, use it as resource Middleware after authentication
+func (l *RateLimit) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	route := selectedRoute(request)
+	if route == nil {
+		chain.ProcessFilter(request, response)
+		return
+	}
+	resource, action := routeLabels(route)
+	key := l.Key
+	if key == nil {
+		key = RateLimitKey
+	}
+	bucketKey := key(request) + "|" + resource
+	rate, ok := l.Rates[Action(action)]
+	if ok {
+		bucketKey += "|" + action
+	} else {
+		rate = l.Rate
+	}
+	cost := 1
+	if Action(action) == ActionList {
+		if filter, err := ParseFilter(request.QueryParameter("filter")); err == nil {
+			costOf := l.Cost
+			if costOf == nil {
+				costOf = QueryCost
+			}
+			cost = costOf(filter)
+		}
+	}
+	if capacity := rate.capacity(); float64(cost) > capacity {
+		err := fmt.Errorf("query costs %d tokens, more than %d of the rate limit", cost, int(capacity))
+		writeResult(response, errorResult(http.StatusBadRequest, "rate limit", err))
+		return
+	}
+	result, err := l.Store.Take(bucketKey, rate, cost)
+	if err != nil {
+		writeResult(response, errorResult(http.StatusInternalServerError, "rate limit", err))
+		return
+	}
+	header := response.Header()
+	header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	header.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.Reset)))
+	if !result.Allowed {
+		header.Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+		writeResult(response, errorResult(http.StatusTooManyRequests, "rate limit", errRateLimited))
+		return
+	}
+	chain.ProcessFilter(request, response)
+}
+
+// ceilSeconds is whole seconds of the duration rounded up
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimitKey is the authenticated principal of the request, or the client IP without principal,
+// credentials are not used before they are verified, e.g. API keys are counted by their principals after APIKeyAuth
+func RateLimitKey(request *restful.Request) string {
+	if principal := PrincipalFromRequest(request.Request); principal != nil {
+		return "principal:" + principal.Tenant + "/" + principal.ID
+	}
+	return "ip:" + clientIP(request.Request)
+}
+
+// QueryCost is tokens of the query, one token and one more per preload and per CostPageSize rows of limit,
+// the query without limit costs CostUnbounded more
+func QueryCost(filter *Filter) int {
+	if filter == nil {
+		return 1
+	}
+	cost := 1 + len(filter.Preloads)
+	if filter.Limit <= 0 {
+		return cost + CostUnbounded
+	}
+	return cost + (filter.Limit-1)/CostPageSize
+}
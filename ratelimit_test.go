@@ -0,0 +1,55 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestRateLimit(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	now := time.Now()
+	store := grest.NewMemoryLimitStore()
+	store.Now = func() time.Time { return now }
+	limit := grest.NewRateLimit(grest.Rate{Limit: 2, Period: time.Minute})
+	limit.Store = store
+	limit.Rates = map[grest.Action]grest.Rate{grest.ActionList: {Limit: 12, Period: time.Minute}}
+	h.AddResource(&Doc{}, grest.ResourceConfig{Middleware: []restful.FilterFunction{limit.Filter}})
+	h.DB.Create(&Doc{Title: "a"})
+
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Header(grest.HeaderRateLimitRemaining, "1")
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Header(grest.HeaderRateLimitRemaining, "0")
+	h.GET("/doc/1").Expect().Status(http.StatusTooManyRequests).
+		Header(grest.HeaderRetryAfter, "30").Header(grest.HeaderRateLimitLimit, "2")
+	// the unverified API key shares the bucket of the client IP
+	h.GET("/doc/1").Header(grest.APIKeyHeader, "k1").Expect().Status(http.StatusTooManyRequests)
+
+	// the list has its own bucket, the query without limit costs 11 tokens
+	h.GET("/doc").Expect().Status(http.StatusOK).Header(grest.HeaderRateLimitRemaining, "1")
+	h.GET("/doc").Expect().Status(http.StatusTooManyRequests).Header(grest.HeaderRetryAfter, "50")
+	h.GET("/doc").Filter(&grest.Filter{Limit: 10}).Expect().Status(http.StatusOK).Header(grest.HeaderRateLimitRemaining, "0")
+	// the query costing more than the capacity is rejected
+	h.GET("/doc").Filter(&grest.Filter{Preloads: []string{"a", "b"}}).Expect().Status(http.StatusBadRequest)
+
+	now = now.Add(time.Minute)
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Header(grest.HeaderRateLimitReset, "30")
+	h.GET("/doc").Expect().Status(http.StatusOK)
+}
+
+func TestQueryCost(t *testing.T) {
+	for cost, filter := range map[int]*grest.Filter{
+		1:  {Limit: 100},
+		2:  {Limit: 101},
+		3:  {Limit: 10, Preloads: []string{"Users", "Company"}},
+		11: {},
+	} {
+		if got := grest.QueryCost(filter); got != cost {
+			t.Fatalf("expected cost %d of %+v, got %d", cost, filter, got)
+		}
+	}
+}
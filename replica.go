@@ -0,0 +1,216 @@
+package grest
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// HeaderReadPrimary is request header forcing queries of the request to the primary, e.g. "X-Read-Primary: true"
+const HeaderReadPrimary = "X-Read-Primary"
+
+// Replica is read replica of ReplicaPool
+type Replica struct {
+	DB *gorm.DB
+	// Weight is share of queries, default is 1, equal weights are round-robin
+	Weight int
+
+	unhealthy int32
+	current   int
+}
+
+// Healthy is whether the last health check of the replica passed
+func (r *Replica) Healthy() bool {
+	return atomic.LoadInt32(&r.unhealthy) == 0
+}
+
+// ReplicaPool route queries of contexts to read replicas, writes stay on the primary DB of Context
+// after a write the session reads from the primary within Window, so it reads its own writes
+// the replicas serve the db of Key, contexts routed by DBRouter to other dbs are skipped, use a pool per key
+//
+//	pool := grest.NewReplicaPool(replica1, replica2)
+//	pool.Window = 5 * time.Second
+//	api.Hooks = append(api.Hooks, pool.Hook())
+//	go pool.Run(ctx)
+type ReplicaPool struct {
+	Replicas []*Replica
+	// Key is DBRouter key of the primary db of the replicas, empty is the default db, see Context.DBKey
+	Key string
+	// Window is read-your-writes window of a session after its write, 0 is disabled
+	Window time.Duration
+	// Session identify the session of the context, default is the principal,
+	// requests without principal have no session, set it to e.g. a cookie to read their own writes,
+	// the client ip is shared by all clients behind a proxy
+	Session func(cxt *Context) string
+	// Check is health check of replicas, default is ping
+	Check func(db *gorm.DB) error
+	// Interval is interval of health checks, default is 10 seconds
+	Interval time.Duration
+
+	mu     sync.Mutex
+	writes map[string]time.Time
+}
+
+// NewReplicaPool is create ReplicaPool of replicas with weight 1
+func NewReplicaPool(replicas ...*gorm.DB) *ReplicaPool {
+	pool := &ReplicaPool{Interval: 10 * time.Second}
+	for _, db := range replicas {
+		pool.Add(db, 1)
+	}
+	return pool
+}
+
+// Add add the replica with weight, it is healthy until checked
+func (p *ReplicaPool) Add(db *gorm.DB, weight int) *Replica {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	replica := &Replica{DB: db, Weight: weight}
+	p.Replicas = append(p.Replicas, replica)
+	return replica
+}
+
+// Next choose a healthy replica by smooth weighted round-robin, nil if none is healthy
+func (p *ReplicaPool) Next() *gorm.DB {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		best  *Replica
+		total int
+	)
+	for _, replica := range p.Replicas {
+		if !replica.Healthy() {
+			continue
+		}
+		weight := replica.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		replica.current += weight
+		total += weight
+		if best == nil || replica.current > best.current {
+			best = replica
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	best.current -= total
+	return best.DB
+}
+
+// MarkWrite start the read-your-writes window of the session
+func (p *ReplicaPool) MarkWrite(session string) {
+	if p.Window <= 0 || session == "" {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.writes == nil {
+		p.writes = map[string]time.Time{}
+	}
+	if len(p.writes) >= 1024 {
+		for key, expires := range p.writes {
+			if now.After(expires) {
+				delete(p.writes, key)
+			}
+		}
+	}
+	p.writes[session] = now.Add(p.Window)
+}
+
+// recentWrite is whether the session is in its read-your-writes window
+func (p *ReplicaPool) recentWrite(session string) bool {
+	if p.Window <= 0 || session == "" {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	expires, ok := p.writes[session]
+	return ok && time.Now().Before(expires)
+}
+
+// session resolve session of the context
+func (p *ReplicaPool) session(cxt *Context) string {
+	if p.Session != nil {
+		return p.Session(cxt)
+	}
+	if cxt.Principal != nil && cxt.Principal.ID != "" {
+		return "principal:" + cxt.Principal.Tenant + "/" + cxt.Principal.ID
+	}
+	return ""
+}
+
+// Hook is ContextHook setting ReadDB of the context
+// writes start the window of the session, queries use the primary within it, with HeaderReadPrimary
+// or if no replica is healthy. it must run after hooks changing DB, e.g. DBRouter.Hook
+func (p *ReplicaPool) Hook() ContextHook {
+	return func(cxt *Context) error {
+		if cxt.DBKey != p.Key {
+			return nil
+		}
+		session := p.session(cxt)
+		if cxt.Request != nil && cxt.Request.Request != nil {
+			req := cxt.Request.Request
+			switch req.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+			default:
+				p.MarkWrite(session)
+				return nil
+			}
+			if primary, _ := strconv.ParseBool(req.Header.Get(HeaderReadPrimary)); primary {
+				return nil
+			}
+		}
+		if p.recentWrite(session) {
+			return nil
+		}
+		if db := p.Next(); db != nil {
+			cxt.ReadDB = db
+		}
+		return nil
+	}
+}
+
+// CheckHealth check every replica once
+func (p *ReplicaPool) CheckHealth() {
+	p.mu.Lock()
+	replicas := append([]*Replica{}, p.Replicas...)
+	p.mu.Unlock()
+	for _, replica := range replicas {
+		var err error
+		if p.Check != nil {
+			err = p.Check(replica.DB)
+		} else {
+			err = replica.DB.DB().Ping()
+		}
+		if err != nil {
+			atomic.StoreInt32(&replica.unhealthy, 1)
+		} else {
+			atomic.StoreInt32(&replica.unhealthy, 0)
+		}
+	}
+}
+
+// Run check health of replicas until ctx is done
+func (p *ReplicaPool) Run(ctx context.Context) error {
+	interval := p.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.CheckHealth()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package grest_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestReplicaPool(t *testing.T) {
+	replicas := make([]*gorm.DB, 2)
+	for i := range replicas {
+		db, err := gorm.Open("sqlite3", fmt.Sprintf("file:replica_%d?mode=memory&cache=shared", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+		db.DB().SetMaxIdleConns(1)
+		db.AutoMigrate(&Doc{})
+		db.Create(&Doc{Title: fmt.Sprintf("replica %d", i)})
+		replicas[i] = db
+	}
+
+	h := gresttest.New(t)
+	defer h.Close()
+	pool := grest.NewReplicaPool()
+	pool.Add(replicas[0], 2)
+	pool.Add(replicas[1], 1)
+	pool.Window = time.Minute
+	route := func(cxt *grest.Context) error {
+		if id := cxt.Request.HeaderParameter("X-User"); id != "" {
+			cxt.Principal = &grest.Principal{ID: id}
+		}
+		cxt.DBKey = cxt.Request.HeaderParameter("X-DB")
+		return nil
+	}
+	h.API.Hooks = []grest.ContextHook{route, pool.Hook()}
+	h.AddResource(&Doc{})
+
+	h.GET("/doc").Expect().Contains("replica 0")
+	h.GET("/doc").Expect().Contains("replica 1")
+	h.GET("/doc").Expect().Contains("replica 0")
+	h.GET("/doc/1").Expect().Contains("replica 0")
+	h.GET("/doc").Header(grest.HeaderReadPrimary, "true").Expect().Count(0)
+
+	pool.Check = func(db *gorm.DB) error {
+		if db == replicas[0] {
+			return errors.New("down")
+		}
+		return nil
+	}
+	pool.CheckHealth()
+	if pool.Replicas[0].Healthy() || !pool.Replicas[1].Healthy() {
+		t.Fatal("expected replica 0 unhealthy")
+	}
+	h.GET("/doc").Expect().Contains("replica 1")
+	h.GET("/doc").Expect().Contains("replica 1")
+
+	// the session reads its own writes from the primary, anonymous writes have no session
+	h.POST("/doc").JSON(&Doc{Title: "primary"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Expect().Contains("replica 1")
+	h.POST("/doc").Header("X-User", "u1").JSON(&Doc{Title: "primary"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Header("X-User", "u1").Expect().Count(2).Contains("primary")
+	h.GET("/doc").Header("X-User", "u2").Expect().Contains("replica 1")
+
+	// contexts routed to another db are not served by the replicas
+	h.GET("/doc").Header("X-DB", "b").Expect().Count(2).Contains("primary")
+}
@@ -0,0 +1,282 @@
+package grest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+)
+
+var errRouterOpen = errors.New("db router has no open function")
+
+var (
+	// schemaPattern is valid postgres schema name, it is put into DSN without quoting
+	schemaPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+	// routerKeyPattern is default valid routing key
+	routerKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+)
+
+// DBRouter pick db of the request by tenant key, e.g. database or schema per tenant
+// dbs are opened on first use and cached, Migrate runs once after opening, failed ones are not cached
+//
+//	router := &grest.DBRouter{Open: func(key string) (*gorm.DB, error) {
+//	    dsn, err := grest.SearchPathDSN(dsn, "tenant_"+key)
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return gorm.Open("postgres", dsn)
+//	}}
+//	api.Hooks = append(api.Hooks, tenancy.Hook(), router.Hook())
+type DBRouter struct {
+	// Open open db of the key, the key comes from the request and should be checked before use
+	Open func(key string) (*gorm.DB, error)
+	// Migrate run on first use of the db, e.g. AutoMigrate, db is not cached if it fails
+	Migrate func(key string, db *gorm.DB) error
+	// Key resolve routing key of the context, default is TenantID
+	Key func(cxt *Context) string
+	// Default is used without routing key, the db of context is kept if it is nil
+	Default *gorm.DB
+	// Valid check the key before opening, e.g. allowed tenants, invalid keys get 400
+	// default allows 1 to 64 letters, digits, '_', '.' and '-'
+	Valid func(key string) bool
+	// MaxOpen is max cached dbs, the least recently used one is closed if it is exceeded, 0 is unlimited
+	// requests still using the closed db fail, it should be more than keys used concurrently
+	MaxOpen int
+
+	mu   sync.Mutex
+	dbs  map[string]*routedDB
+	used uint64
+}
+
+// routedDB is cached db of a key, mu serialize the first opening, used is sequence of the last use
+type routedDB struct {
+	mu   sync.Mutex
+	db   *gorm.DB
+	used uint64
+}
+
+// DB get db of the key, it is opened and migrated on first use
+func (r *DBRouter) DB(key string) (*gorm.DB, error) {
+	if key == "" {
+		return r.Default, nil
+	}
+	if r.Open == nil {
+		return nil, errRouterOpen
+	}
+	if !r.valid(key) {
+		return nil, NewHTTPError(http.StatusBadRequest, fmt.Errorf("invalid db key %q", key))
+	}
+	r.mu.Lock()
+	if r.dbs == nil {
+		r.dbs = map[string]*routedDB{}
+	}
+	entry, ok := r.dbs[key]
+	if !ok {
+		entry = new(routedDB)
+		r.dbs[key] = entry
+	}
+	r.used++
+	entry.used = r.used
+	r.mu.Unlock()
+
+	db, opened, err := r.open(key, entry)
+	if opened {
+		r.evict(key)
+	}
+	return db, err
+}
+
+// open open and migrate db of the entry if it is not opened, opened is whether it is opened by this call
+func (r *DBRouter) open(key string, entry *routedDB) (db *gorm.DB, opened bool, err error) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.db != nil {
+		return entry.db, false, nil
+	}
+	db, err = r.Open(key)
+	if err != nil {
+		r.remove(key, entry)
+		return nil, false, fmt.Errorf("open db of %q: %v", key, err)
+	}
+	if r.Migrate != nil {
+		if err := r.Migrate(key, db); err != nil {
+			db.Close()
+			r.remove(key, entry)
+			return nil, false, fmt.Errorf("migrate db of %q: %v", key, err)
+		}
+	}
+	entry.db = db
+	return db, true, nil
+}
+
+// valid is whether the key can be opened
+func (r *DBRouter) valid(key string) bool {
+	if r.Valid != nil {
+		return r.Valid(key)
+	}
+	return routerKeyPattern.MatchString(key)
+}
+
+// remove delete the entry of the key if it is not replaced
+func (r *DBRouter) remove(key string, entry *routedDB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dbs[key] == entry {
+		delete(r.dbs, key)
+	}
+}
+
+// evict close least recently used dbs except the key while MaxOpen is exceeded
+func (r *DBRouter) evict(key string) {
+	if r.MaxOpen <= 0 {
+		return
+	}
+	var evicted []*routedDB
+	r.mu.Lock()
+	for len(r.dbs) > r.MaxOpen {
+		oldest := ""
+		for k, entry := range r.dbs {
+			if k != key && (oldest == "" || entry.used < r.dbs[oldest].used) {
+				oldest = k
+			}
+		}
+		if oldest == "" {
+			break
+		}
+		evicted = append(evicted, r.dbs[oldest])
+		delete(r.dbs, oldest)
+	}
+	r.mu.Unlock()
+	for _, entry := range evicted {
+		entry.mu.Lock()
+		if entry.db != nil {
+			entry.db.Close()
+		}
+		entry.mu.Unlock()
+	}
+}
+
+// Keys return keys of opened dbs
+func (r *DBRouter) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0, len(r.dbs))
+	for key, entry := range r.dbs {
+		entry.mu.Lock()
+		if entry.db != nil {
+			keys = append(keys, key)
+		}
+		entry.mu.Unlock()
+	}
+	return keys
+}
+
+// Close close the db of the key, it is opened again on next use
+func (r *DBRouter) Close(key string) error {
+	r.mu.Lock()
+	entry, ok := r.dbs[key]
+	delete(r.dbs, key)
+	r.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.db == nil {
+		return nil
+	}
+	return entry.db.Close()
+}
+
+// CloseAll close all opened dbs
+func (r *DBRouter) CloseAll() error {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.dbs))
+	for key := range r.dbs {
+		keys = append(keys, key)
+	}
+	r.mu.Unlock()
+	var result error
+	for _, key := range keys {
+		if err := r.Close(key); err != nil && result == nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// key resolve routing key of the context
+func (r *DBRouter) key(cxt *Context) string {
+	if r.Key != nil {
+		return r.Key(cxt)
+	}
+	return cxt.TenantID
+}
+
+// Hook is ContextHook setting the routed db into Context and request context
+// it must run after the hook resolving the tenant, e.g. Tenancy.Hook
+func (r *DBRouter) Hook() ContextHook {
+	return func(cxt *Context) error {
+		key := r.key(cxt)
+		db, err := r.DB(key)
+		if isHTTPError(err) {
+			return err
+		}
+		if err != nil {
+			return NewHTTPError(http.StatusServiceUnavailable, err)
+		}
+		if db == nil {
+			return nil
+		}
+		cxt.SetDB(db)
+		cxt.DBKey = key
+		if cxt.Request != nil && cxt.Request.Request != nil {
+			cxt.Request.Request = cxt.Request.Request.WithContext(context.WithValue(cxt.Request.Request.Context(), ContextDBName, db))
+		}
+		return nil
+	}
+}
+
+// Middleware is net/http middleware putting the routed db into request context with ContextDBName
+func (r *DBRouter) Middleware(resolver TenantResolver, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		db, err := r.DB(resolver(req))
+		if err != nil && !isHTTPError(err) {
+			err = NewHTTPError(http.StatusServiceUnavailable, err)
+		}
+		if err != nil {
+			// the status of HTTPError is responded, e.g. 400 of an invalid key, as Hook does
+			writeHTTPResult(w, restful.MIME_JSON, errorResult(http.StatusInternalServerError, "route db", err))
+			return
+		}
+		if db != nil {
+			req = req.WithContext(context.WithValue(req.Context(), ContextDBName, db))
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// SearchPathDSN set postgres search_path of the DSN, both URL and key=value DSN are supported
+func SearchPathDSN(dsn, schema string) (string, error) {
+	if !schemaPattern.MatchString(schema) {
+		return "", fmt.Errorf("invalid schema name %q", schema)
+	}
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return "", err
+		}
+		query := u.Query()
+		query.Set("search_path", schema)
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	return strings.TrimSpace(dsn + " search_path=" + schema), nil
+}
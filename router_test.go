@@ -0,0 +1,95 @@
+package grest_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestDBRouter(t *testing.T) {
+	migrated := map[string]int{}
+	router := &grest.DBRouter{
+		Open: func(key string) (*gorm.DB, error) {
+			db, err := gorm.Open("sqlite3", fmt.Sprintf("file:router_%s?mode=memory&cache=shared", key))
+			if err == nil {
+				db.DB().SetMaxIdleConns(1)
+			}
+			return db, err
+		},
+		Migrate: func(key string, db *gorm.DB) error {
+			migrated[key]++
+			return db.AutoMigrate(&Note{}).Error
+		},
+	}
+	defer router.CloseAll()
+
+	h := gresttest.New(t)
+	defer h.Close()
+	tenancy := grest.Tenancy{Resolver: grest.HeaderTenant("X-Tenant-ID"), Required: true}
+	h.API.Hooks = []grest.ContextHook{tenancy.Hook(), router.Hook()}
+	if _, err := h.API.AddResource(&Note{}); err != nil {
+		t.Fatal(err)
+	}
+
+	h.POST("/note").Header("X-Tenant-ID", "a").JSON(&Note{Title: "a1"}).Expect().Status(http.StatusOK)
+	h.POST("/note").Header("X-Tenant-ID", "a").JSON(&Note{Title: "a2"}).Expect().Status(http.StatusOK)
+	h.GET("/note").Header("X-Tenant-ID", "a").Expect().Status(http.StatusOK).Count(2)
+	h.GET("/note").Header("X-Tenant-ID", "b").Expect().Status(http.StatusOK).Count(0)
+	if migrated["a"] != 1 || migrated["b"] != 1 || len(router.Keys()) != 2 {
+		t.Fatalf("unexpected migrations %v", migrated)
+	}
+
+	// invalid keys are rejected, failed ones are not cached, the least recently used db is closed
+	h.GET("/note").Header("X-Tenant-ID", "a/../b").Expect().Status(http.StatusBadRequest)
+	router.Valid = func(key string) bool { return key != "c" }
+	h.GET("/note").Header("X-Tenant-ID", "c").Expect().Status(http.StatusBadRequest)
+	router.Valid = nil
+	open := router.Open
+	router.Open = func(key string) (*gorm.DB, error) { return nil, fmt.Errorf("unavailable") }
+	h.GET("/note").Header("X-Tenant-ID", "d").Expect().Status(http.StatusServiceUnavailable)
+	router.Open = open
+	router.MaxOpen = 2
+	h.GET("/note").Header("X-Tenant-ID", "a").Expect().Status(http.StatusOK)
+	h.GET("/note").Header("X-Tenant-ID", "e").Expect().Status(http.StatusOK)
+	if keys := router.Keys(); len(keys) != 2 || (keys[0] != "a" && keys[1] != "a") {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	h.GET("/note").Header("X-Tenant-ID", "b").Expect().Status(http.StatusOK)
+	if migrated["b"] != 2 || migrated["d"] != 0 {
+		t.Fatalf("unexpected migrations %v", migrated)
+	}
+
+	// the net/http middleware responds the status of the routing error
+	handler := router.Middleware(grest.HeaderTenant("X-Tenant-ID"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(grest.ContextDBName) == nil {
+			t.Error("expected routed db in request context")
+		}
+	}))
+	serve := func(tenant string, status int) {
+		request := httptest.NewRequest(http.MethodGet, "/note", nil)
+		request.Header.Set("X-Tenant-ID", tenant)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != status {
+			t.Fatalf("unexpected status %d of tenant %s", recorder.Code, tenant)
+		}
+	}
+	serve("a", http.StatusOK)
+	serve("a/../b", http.StatusBadRequest)
+	router.Open = func(key string) (*gorm.DB, error) { return nil, fmt.Errorf("unavailable") }
+	serve("f", http.StatusServiceUnavailable)
+	router.Open = open
+
+	dsn, err := grest.SearchPathDSN("postgres://u@localhost/app?sslmode=disable", "tenant_a")
+	if err != nil || dsn != "postgres://u@localhost/app?search_path=tenant_a&sslmode=disable" {
+		t.Fatalf("unexpected dsn %q %v", dsn, err)
+	}
+	if _, err := grest.SearchPathDSN("host=localhost", "a;drop"); err == nil {
+		t.Fatal("expected invalid schema error")
+	}
+}
@@ -0,0 +1,211 @@
+package grest
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+)
+
+// ResourceSchema is resource metadata for admin UIs
+type ResourceSchema struct {
+	Name         string        `json:"name"`
+	Label        string        `json:"label"`
+	Path         string        `json:"path"`
+	PrimaryKey   string        `json:"primaryKey"`
+	DisplayField string        `json:"displayField"`
+	Fields       []FieldSchema `json:"fields"`
+	Capabilities []string      `json:"capabilities"`
+}
+
+// FieldSchema is field metadata of resource
+// it can be adjusted with grest tag, e.g. `grest:"label:User Name;required;nofilter;nosort"`
+type FieldSchema struct {
+	Name       string          `json:"name"`
+	Column     string          `json:"column,omitempty"`
+	Label      string          `json:"label"`
+	Type       string          `json:"type"`
+	Primary    bool            `json:"primary"`
+	Filterable bool            `json:"filterable"`
+	Sortable   bool            `json:"sortable"`
+	Required   bool            `json:"required"`
+	Relation   *RelationSchema `json:"relation,omitempty"`
+}
+
+// RelationSchema is relation metadata of field
+type RelationSchema struct {
+	Kind        string   `json:"kind"`
+	Resource    string   `json:"resource"`
+	ForeignKeys []string `json:"foreignKeys"`
+}
+
+// NewResourceSchema is create resource schema from gorm model struct
+func NewResourceSchema(value interface{}, urlPath string, capabilities []string) *ResourceSchema {
+	name := ModelType(value).Name()
+	schema := &ResourceSchema{
+		Name:         name,
+		Label:        HumanizeString(name),
+		Path:         urlPath,
+		Capabilities: capabilities,
+	}
+
+	scope := gorm.Scope{Value: value}
+	modelStruct := scope.GetModelStruct()
+	for _, sf := range modelStruct.StructFields {
+		if sf.IsIgnored {
+			continue
+		}
+		field := newFieldSchema(sf)
+		if field.Name == "-" {
+			continue
+		}
+		if field.Primary && schema.PrimaryKey == "" {
+			schema.PrimaryKey = field.Name
+		}
+		schema.Fields = append(schema.Fields, field)
+	}
+
+	// display field follows Stringify, Name, Title, Code, else primary key
+	for _, column := range []string{"Name", "Title", "Code"} {
+		if field, ok := scope.FieldByName(column); ok && field.IsNormal {
+			schema.DisplayField = strings.Split(GetStructTagJSON(field), ",")[0]
+			break
+		}
+	}
+	if schema.DisplayField == "" {
+		schema.DisplayField = schema.PrimaryKey
+	}
+	return schema
+}
+
+// newFieldSchema is create field schema from gorm struct field
+func newFieldSchema(sf *gorm.StructField) FieldSchema {
+	setting := ParseTagOption(sf.Tag.Get("grest"))
+	field := FieldSchema{
+		Name:    strings.Split(GetStructTagJSON(&gorm.Field{StructField: sf}), ",")[0],
+		Label:   HumanizeString(sf.Name),
+		Type:    fieldDataType(sf.Struct.Type),
+		Primary: sf.IsPrimaryKey,
+	}
+	if field.Name == "" {
+		field.Name = sf.Name
+	}
+	if label, ok := setting["LABEL"]; ok && label != "LABEL" {
+		field.Label = label
+	}
+
+	if sf.Relationship != nil {
+		field.Relation = &RelationSchema{
+			Kind:        sf.Relationship.Kind,
+			Resource:    ModelType(reflect.New(sf.Struct.Type).Interface()).Name(),
+			ForeignKeys: sf.Relationship.ForeignDBNames,
+		}
+		field.Type = "relation"
+		return field
+	}
+
+	if sf.IsNormal {
+		field.Column = sf.DBName
+		_, noFilter := setting["NOFILTER"]
+		_, noSort := setting["NOSORT"]
+		field.Filterable = !noFilter
+		field.Sortable = !noSort
+	}
+	if _, ok := setting["REQUIRED"]; ok {
+		field.Required = true
+	} else if _, ok := sf.TagSettingsGet("NOT NULL"); ok && !sf.IsPrimaryKey {
+		_, hasDefault := sf.TagSettingsGet("DEFAULT")
+		field.Required = !hasDefault
+	}
+	return field
+}
+
+// fieldDataType is type name of field for admin UIs
+func fieldDataType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "datetime"
+	case t.Kind() == reflect.Struct:
+		return DataType(t.Name())
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "bytes"
+		}
+		return "array"
+	case t.Kind() == reflect.Map:
+		return "object"
+	}
+	return DataType(t.Kind().String())
+}
+
+// capabilities return actions of the registered routes
+func (g *GenericAPIView) capabilities() []string {
+	var capabilities []string
+	if g.allowMethod(http.MethodGet) {
+		capabilities = append(capabilities, string(ActionList), string(ActionRead))
+	}
+	if g.allowMethod(http.MethodPost) {
+		capabilities = append(capabilities, string(ActionCreate))
+	}
+	if g.allowMethod(http.MethodPut) || g.allowMethod(http.MethodPatch) {
+		capabilities = append(capabilities, string(ActionUpdate))
+	}
+	if g.allowMethod(http.MethodDelete) {
+		capabilities = append(capabilities, string(ActionDelete))
+	}
+	return capabilities
+}
+
+// Schema is resource schema of the GenericAPIView
+func (g *GenericAPIView) Schema() *ResourceSchema {
+	urlPath := ""
+	if g.WS != nil {
+		urlPath = strings.TrimPrefix(g.WS.RootPath(), "/")
+	}
+	return NewResourceSchema(g.Value, urlPath, g.capabilities())
+}
+
+// FindSchema adds a request function to handle GET _schema request.
+func (g *GenericAPIView) FindSchema(request *restful.Request, response *restful.Response) {
+	response.WriteEntity(g.Schema())
+}
+
+// MetaPath is default path of the web service serving schemas of all resources of API
+const MetaPath = "/_meta"
+
+// AddMetaService serve GET schemas of all resources of API at path of config, default is MetaPath,
+// it is not mounted by AddResource, protect it by Middleware of config
+//
+//	api.AddMetaService(grest.ResourceConfig{Middleware: []restful.FilterFunction{auth.Filter}})
+func (api *API) AddMetaService(configs ...ResourceConfig) (*restful.WebService, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	urlPath := strings.Trim(config.Path, "/")
+	if urlPath == "" {
+		urlPath = strings.Trim(MetaPath, "/")
+	}
+	ws := new(restful.WebService)
+	ws.Path("/" + urlPath).Produces(restful.MIME_JSON)
+	for _, filter := range config.Middleware {
+		ws.Filter(filter)
+	}
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		schemas := make([]*ResourceSchema, 0, len(api.resources))
+		for _, res := range api.resources {
+			schemas = append(schemas, res.View.Schema())
+		}
+		response.WriteEntity(schemas)
+	}).Doc("schemas of all resources").Returns(http.StatusOK, "query success", []ResourceSchema{}))
+	if err := api.add(ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
@@ -0,0 +1,62 @@
+package grest_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type Article struct {
+	ID     uint   `json:"id" gorm:"primary_key"`
+	Title  string `json:"title" grest:"label:Headline;required"`
+	Body   string `json:"body" grest:"nofilter;nosort"`
+	Hidden string `json:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	h := gresttest.New(t, &Article{})
+	defer h.Close()
+	h.AddResource(&Company{}, grest.ResourceConfig{Path: "companies", ReadOnly: true})
+
+	schema := new(grest.ResourceSchema)
+	h.GET("/article/_schema").Expect().Status(http.StatusOK).JSON(schema)
+	if schema.Name != "Article" || schema.Path != "article" || schema.PrimaryKey != "id" || schema.DisplayField != "title" {
+		t.Fatalf("unexpected schema %+v", schema)
+	}
+	if len(schema.Fields) != 3 || len(schema.Capabilities) != 5 {
+		t.Fatalf("unexpected fields or capabilities %+v", schema)
+	}
+	title, body := schema.Fields[1], schema.Fields[2]
+	if title.Label != "Headline" || !title.Required || !title.Filterable || body.Filterable || body.Sortable {
+		t.Fatalf("unexpected fields %+v", schema.Fields)
+	}
+
+	// /_meta is mounted explicitly, with its middleware
+	h.GET(grest.MetaPath).Expect().Status(http.StatusNotFound)
+	deny := func(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+		if request.HeaderParameter("X-Admin") == "" {
+			response.WriteErrorString(http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		chain.ProcessFilter(request, response)
+	}
+	if _, err := h.API.AddMetaService(grest.ResourceConfig{Middleware: []restful.FilterFunction{deny}}); err != nil {
+		t.Fatal(err)
+	}
+	h.GET(grest.MetaPath).Expect().Status(http.StatusUnauthorized)
+	var schemas []grest.ResourceSchema
+	h.GET(grest.MetaPath).Header("X-Admin", "1").Expect().Status(http.StatusOK).JSON(&schemas)
+	if len(schemas) != 2 || schemas[1].Path != "companies" || len(schemas[1].Capabilities) != 2 {
+		t.Fatalf("unexpected schemas %+v", schemas)
+	}
+	users := schemas[1].Fields[len(schemas[1].Fields)-1]
+	if users.Relation == nil || users.Relation.Kind != "has_many" || users.Relation.Resource != "User" {
+		t.Fatalf("unexpected relation %+v", users)
+	}
+	if _, err := h.API.AddMetaService(); err == nil {
+		t.Fatal("expected error of duplicate meta path")
+	}
+}
@@ -0,0 +1,296 @@
+package grest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/jinzhu/gorm"
+)
+
+// slowFilterKey is db setting of slowMark of FindMany, see SlowLog.Instrument
+const slowFilterKey = "grest:slow_filter"
+
+// slowMark mark the query of result as the query of filter, preload queries of other values are not marked
+type slowMark struct {
+	filter *Filter
+	result interface{}
+}
+
+// marks is whether the scope queries the result of the mark
+func (m *slowMark) marks(scope *gorm.Scope) bool {
+	rv, value := reflect.ValueOf(m.result), reflect.ValueOf(scope.Value)
+	return rv.Kind() == reflect.Ptr && value.Kind() == reflect.Ptr && rv.Pointer() == value.Pointer()
+}
+
+// explainPrefix is EXPLAIN statement of supported dialects
+var explainPrefix = map[string]string{
+	"sqlite3":  "EXPLAIN QUERY PLAN ",
+	"mysql":    "EXPLAIN ",
+	"postgres": "EXPLAIN ",
+}
+
+// SlowQuery is a FindMany query slower than the threshold
+type SlowQuery struct {
+	Time     time.Time     `json:"time"`
+	Resource string        `json:"resource"`
+	SQL      string        `json:"sql"`
+	Vars     []interface{} `json:"vars"`
+	Duration float64       `json:"durationMs"`
+	Filter   *Filter       `json:"filter,omitempty"`
+	Shape    string        `json:"shape"`
+	// Plan is EXPLAIN output, one row per line, empty if the dialect is not supported
+	Plan []string `json:"plan,omitempty"`
+}
+
+// SlowShape is statistics of slow queries of a filter shape, see FilterShape
+type SlowShape struct {
+	Resource string     `json:"resource"`
+	Shape    string     `json:"shape"`
+	Count    int        `json:"count"`
+	Max      float64    `json:"maxMs"`
+	Total    float64    `json:"totalMs"`
+	Last     *SlowQuery `json:"last"`
+}
+
+// SlowLog log FindMany queries slower than Threshold as JSON lines and keep the most frequent slow filter shapes
+//
+//	slow := grest.NewSlowLog(200*time.Millisecond, os.Stderr)
+//	slow.Instrument(db)
+//	api.AddSlowLogService(slow, grest.ResourceConfig{Middleware: []restful.FilterFunction{adminOnly}})
+type SlowLog struct {
+	Threshold time.Duration
+	// Explain capture EXPLAIN output of slow queries on sqlite3, mysql and postgres,
+	// it runs in background on another connection, the query is recorded after it
+	Explain bool
+	// MaxExplains is max number of EXPLAIN running at once, slow queries beyond it are recorded without plan, 0 is unlimited
+	MaxExplains int
+	// MaxShapes is max number of kept shapes, the least frequent is dropped when it is exceeded
+	MaxShapes  int
+	Writer     io.Writer
+	mu         sync.Mutex
+	shapes     map[string]*SlowShape
+	explaining int
+	pending    sync.WaitGroup
+}
+
+// NewSlowLog is create SlowLog writing into w, default is stdout
+func NewSlowLog(threshold time.Duration, w io.Writer) *SlowLog {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &SlowLog{Threshold: threshold, Explain: true, MaxExplains: 4, MaxShapes: 1000, Writer: w, shapes: map[string]*SlowShape{}}
+}
+
+// Instrument detect slow FindMany queries of the db
+func (s *SlowLog) Instrument(db *gorm.DB) {
+	registerCallbacks(db, "grest:slow", nil, func(scope *gorm.Scope, operation string, start time.Time) {
+		duration := time.Since(start)
+		if operation != "query" || duration < s.Threshold {
+			return
+		}
+		value, ok := scope.Get(slowFilterKey)
+		if !ok {
+			return
+		}
+		mark, ok := value.(*slowMark)
+		if !ok || !mark.marks(scope) {
+			return
+		}
+		filter := mark.filter
+		query := &SlowQuery{
+			Time:     start,
+			Resource: scopeResource(scope),
+			SQL:      scope.SQL,
+			Vars:     scope.SQLVars,
+			Duration: float64(duration) / float64(time.Millisecond),
+			Shape:    FilterShape(filter),
+		}
+		if filter != nil {
+			query.Filter = normalizeFilter(filter)
+		}
+		if !s.Explain || !s.startExplain() {
+			s.Record(query)
+			return
+		}
+		// the query may run in a transaction, EXPLAIN runs on another connection of db without blocking it
+		go func() {
+			defer s.endExplain()
+			query.Plan = explain(db, query.SQL, query.Vars)
+			s.Record(query)
+		}()
+	})
+}
+
+// startExplain take a slot of MaxExplains, false if there is none
+func (s *SlowLog) startExplain() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.MaxExplains > 0 && s.explaining >= s.MaxExplains {
+		return false
+	}
+	s.explaining++
+	s.pending.Add(1)
+	return true
+}
+
+// endExplain release the slot of startExplain
+func (s *SlowLog) endExplain() {
+	s.mu.Lock()
+	s.explaining--
+	s.mu.Unlock()
+	s.pending.Done()
+}
+
+// Wait wait for running EXPLAIN, their queries are recorded after it
+func (s *SlowLog) Wait() {
+	s.pending.Wait()
+}
+
+// Record keep the slow query and write it
+func (s *SlowLog) Record(query *SlowQuery) {
+	s.mu.Lock()
+	if s.shapes == nil {
+		s.shapes = map[string]*SlowShape{}
+	}
+	key := query.Resource + " " + query.Shape
+	shape, ok := s.shapes[key]
+	if !ok {
+		if s.MaxShapes > 0 && len(s.shapes) >= s.MaxShapes {
+			s.dropLeast()
+		}
+		shape = &SlowShape{Resource: query.Resource, Shape: query.Shape}
+		s.shapes[key] = shape
+	}
+	shape.Count++
+	shape.Total += query.Duration
+	if query.Duration > shape.Max {
+		shape.Max = query.Duration
+	}
+	shape.Last = query
+	b, err := json.Marshal(query)
+	if err == nil && s.Writer != nil {
+		s.Writer.Write(append(b, '\n'))
+	}
+	s.mu.Unlock()
+}
+
+// dropLeast drop the least frequent shape
+func (s *SlowLog) dropLeast() {
+	var least string
+	for key, shape := range s.shapes {
+		if least == "" || shape.Count < s.shapes[least].Count {
+			least = key
+		}
+	}
+	delete(s.shapes, least)
+}
+
+// Top is the n most frequent slow shapes, all shapes if n <= 0
+func (s *SlowLog) Top(n int) []SlowShape {
+	s.mu.Lock()
+	top := make([]SlowShape, 0, len(s.shapes))
+	for _, shape := range s.shapes {
+		top = append(top, *shape)
+	}
+	s.mu.Unlock()
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Total > top[j].Total
+	})
+	if n > 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Reset clear kept shapes
+func (s *SlowLog) Reset() {
+	s.mu.Lock()
+	s.shapes = map[string]*SlowShape{}
+	s.mu.Unlock()
+}
+
+// AddSlowLogService serve GET top slow shapes at path of config, default is "admin/slow-queries",
+// the query parameter n limits the number of shapes, protect it by Middleware of config
+func (api *API) AddSlowLogService(s *SlowLog, configs ...ResourceConfig) (*restful.WebService, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	urlPath := strings.Trim(config.Path, "/")
+	if urlPath == "" {
+		urlPath = "admin/slow-queries"
+	}
+	ws := new(restful.WebService)
+	ws.Path("/" + urlPath).Produces(restful.MIME_JSON)
+	for _, filter := range config.Middleware {
+		ws.Filter(filter)
+	}
+	ws.Route(ws.GET("").To(func(request *restful.Request, response *restful.Response) {
+		n := 10
+		if raw := request.QueryParameter("n"); raw != "" {
+			var err error
+			if n, err = strconv.Atoi(raw); err != nil {
+				writeResult(response, errorResult(http.StatusBadRequest, "slow queries", err))
+				return
+			}
+		}
+		response.WriteEntity(s.Top(n))
+	}).Doc("most frequent slow filter shapes").Metadata(restfulspec.KeyOpenAPITags, []string{"admin"}).
+		Param(ws.QueryParameter("n", "number of shapes, default is 10").DataType("integer")).
+		Returns(http.StatusOK, "OK", []SlowShape{}))
+	if err := api.add(ws); err != nil {
+		return nil, err
+	}
+	return ws, nil
+}
+
+// explain is EXPLAIN output of the query by the pool of db, nil if the dialect is not supported
+func explain(db *gorm.DB, sql string, vars []interface{}) []string {
+	prefix, ok := explainPrefix[db.Dialect().GetName()]
+	if !ok || sql == "" || db.DB() == nil {
+		return nil
+	}
+	rows, err := db.DB().Query(prefix+sql, vars...)
+	if err != nil {
+		return []string{"explain: " + err.Error()}
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil
+	}
+	var plan []string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			break
+		}
+		cells := make([]string, len(values))
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			cells[i] = fmt.Sprint(value)
+		}
+		plan = append(plan, strings.Join(cells, " "))
+	}
+	return plan
+}
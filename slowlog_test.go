@@ -0,0 +1,53 @@
+package grest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+func TestSlowLog(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	logs := new(bytes.Buffer)
+	slow := grest.NewSlowLog(0, logs)
+	slow.Instrument(h.DB)
+	h.AddResource(&Doc{})
+	if _, err := h.API.AddSlowLogService(slow); err != nil {
+		t.Fatal(err)
+	}
+
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	h.GET("/doc").Filter(&grest.Filter{Where: []interface{}{"title = ?", "a"}}).Expect().Count(1)
+	h.GET("/doc").Filter(&grest.Filter{Where: []interface{}{"title  =  ?", "b"}}).Expect().Count(0)
+	h.GET("/doc").Filter(&grest.Filter{Order: "id desc"}).Expect().Count(1)
+	h.GET("/doc/1").Expect().Status(http.StatusOK)
+
+	slow.Wait()
+	top := slow.Top(0)
+	if len(top) != 2 || top[0].Shape != `{"where":"title = ?"}` || top[0].Count != 2 || top[0].Resource != "Doc" ||
+		top[1].Shape != `{"order":"id desc"}` || top[1].Count != 1 {
+		t.Fatalf("unexpected top shapes %+v", top)
+	}
+	last := top[0].Last
+	if !strings.Contains(last.SQL, "title  =  ?") || len(last.Vars) != 1 || last.Vars[0] != "b" || len(last.Plan) == 0 {
+		t.Fatalf("unexpected slow query %+v", last)
+	}
+	if lines := strings.Split(strings.TrimSpace(logs.String()), "\n"); len(lines) != 3 {
+		t.Fatalf("unexpected slow logs %s", logs)
+	}
+
+	shapes := []grest.SlowShape{}
+	if err := json.Unmarshal(h.GET("/admin/slow-queries").Query("n", "1").Expect().Status(http.StatusOK).Body(), &shapes); err != nil {
+		t.Fatal(err)
+	}
+	if len(shapes) != 1 || shapes[0].Count != 2 {
+		t.Fatalf("unexpected shapes %+v", shapes)
+	}
+	h.GET("/admin/slow-queries").Query("n", "x").Expect().Status(http.StatusBadRequest)
+}
@@ -0,0 +1,256 @@
+package grest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/emicklei/go-restful-openapi"
+	"github.com/jinzhu/gorm"
+)
+
+var errStreamNotSupported = errors.New("streaming is not supported")
+
+// StreamEvent is event of Stream with its sequence
+type StreamEvent struct {
+	Seq   uint64
+	Event *Event
+	// record is data of the event for matching
+	record interface{}
+}
+
+// Stream is change stream of resources with a bounded replay buffer
+// it serves GET /{resource}/stream as Server-Sent Events, see ResourceConfig.Stream
+type Stream struct {
+	// Heartbeat is interval of keep-alive comments, default is 15 seconds
+	Heartbeat time.Duration
+	// BufferSize is size of the replay buffer, default is 1000
+	BufferSize int
+
+	mu          sync.Mutex
+	seq         uint64
+	buffer      []*StreamEvent
+	subscribers map[chan *StreamEvent]struct{}
+}
+
+// NewStream is create Stream, size is size of the replay buffer
+func NewStream(size int) *Stream {
+	return &Stream{BufferSize: size, Heartbeat: 15 * time.Second}
+}
+
+// Hook is CommitHook publishing the change into the stream
+func (s *Stream) Hook() CommitHook {
+	return func(change *Change) {
+		event, err := change.Event()
+		if err != nil {
+			return
+		}
+		record := change.After
+		if record == nil {
+			record = change.Before
+		}
+		s.Publish(event, record)
+	}
+}
+
+// Publish add the event into the replay buffer and send it to subscribers
+// a subscriber too slow to receive is closed, it can resume with Last-Event-ID
+func (s *Stream) Publish(event *Event, record interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	streamEvent := &StreamEvent{Seq: s.seq, Event: event, record: record}
+	size := s.BufferSize
+	if size <= 0 {
+		size = 1000
+	}
+	if len(s.buffer) >= size {
+		s.buffer = append(s.buffer[:0:0], s.buffer[len(s.buffer)-size+1:]...)
+	}
+	s.buffer = append(s.buffer, streamEvent)
+	for ch := range s.subscribers {
+		select {
+		case ch <- streamEvent:
+		default:
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe return buffered events after lastID and channel of new events
+// complete is false if events after lastID are no longer buffered
+func (s *Stream) Subscribe(lastID uint64) (replay []*StreamEvent, complete bool, events chan *StreamEvent, cancel func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	complete = true
+	if lastID > 0 && len(s.buffer) > 0 && s.buffer[0].Seq > lastID+1 {
+		complete = false
+	}
+	for _, event := range s.buffer {
+		if event.Seq > lastID {
+			replay = append(replay, event)
+		}
+	}
+	if s.subscribers == nil {
+		s.subscribers = map[chan *StreamEvent]struct{}{}
+	}
+	events = make(chan *StreamEvent, 64)
+	s.subscribers[events] = struct{}{}
+	cancel = func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if _, ok := s.subscribers[events]; ok {
+			delete(s.subscribers, events)
+			close(events)
+		}
+	}
+	return replay, complete, events, cancel
+}
+
+// streamRoute register stream route of the resource with the route function of WebService
+func (g *GenericAPIView) streamRoute(route func(Action, *restful.RouteBuilder), tags []string) {
+	route(ActionList, returnsErrors(g.WS.GET("/stream").To(g.StreamChanges).
+		Param(g.WS.QueryParameter("where", `condition of rows, e.g. ["age > ?", 18] - must be a JSON-encoded array`).DataType("string").Required(false)).
+		Param(g.WS.HeaderParameter("Last-Event-ID", "resume after the event").DataType("string").Required(false)).
+		Produces("text/event-stream").
+		Doc("change stream, Server-Sent Events").Metadata(restfulspec.KeyOpenAPITags, tags).
+		Returns(http.StatusOK, "event stream", Event{}), http.StatusBadRequest, http.StatusInternalServerError))
+}
+
+// StreamChanges adds a request function to handle GET request of change stream.
+func (g *GenericAPIView) StreamChanges(request *restful.Request, response *restful.Response) {
+	cxt, err := g.newContext(request, response)
+	if err != nil {
+		writeResult(response, errorResult(http.StatusBadRequest, "request context", err))
+		return
+	}
+	if result := g.stream(cxt, response.ResponseWriter, request.Request); result != nil {
+		writeResult(response, result)
+	}
+}
+
+// stream write matching changes as Server-Sent Events until the request is done
+// the result is not nil if the stream can not be started
+func (g *GenericAPIView) stream(cxt *Context, w http.ResponseWriter, r *http.Request) *Result {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errorResult(http.StatusInternalServerError, "stream", errStreamNotSupported)
+	}
+	decision, denied := g.authorize(cxt, ActionList)
+	if denied != nil {
+		return denied
+	}
+	var where []interface{}
+	if raw := strings.TrimSpace(r.URL.Query().Get("where")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &where); err != nil {
+			return errorResult(http.StatusBadRequest, "stream", err)
+		}
+	}
+	if err := checkMask(g.Value, &Filter{Where: where}, decision.Mask); err != nil {
+		return errorResult(http.StatusForbidden, "stream", err)
+	}
+	matcher, err := NewMatcher(where)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "stream", err)
+	}
+	// EventSource sends Last-Event-ID on reconnecting, lastEventId is for the first connection
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	replay, complete, events, cancel := g.Stream.Subscribe(lastID)
+	defer cancel()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	send := func(event *StreamEvent) bool {
+		data, ok, err := g.streamData(event, cxt, matcher, decision)
+		if err != nil || !ok {
+			return err == nil
+		}
+		_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Event.Type, data)
+		return err == nil
+	}
+	for _, event := range replay {
+		if !send(event) {
+			return nil
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := g.Stream.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return nil
+			}
+		case event, ok := <-events:
+			if !ok || !send(event) {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// streamData encode the event if it is change of the resource visible to the context and matches the where
+func (g *GenericAPIView) streamData(event *StreamEvent, cxt *Context, matcher *Matcher, decision *Decision) ([]byte, bool, error) {
+	if event.record == nil || event.Event.Resource != ModelType(g.Value).Name() {
+		return nil, false, nil
+	}
+	if ok, err := matchScopes(event.record, cxt); err != nil || !ok {
+		return nil, false, err
+	}
+	if !matcher.Match(event.record) {
+		return nil, false, nil
+	}
+	if len(decision.Mask) == 0 {
+		data, err := json.Marshal(event.Event)
+		return data, err == nil, err
+	}
+
+	masked := *event.Event
+	record := copyValue(event.record)
+	maskFields(record, decision.Mask)
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, false, err
+	}
+	masked.Payload = payload
+	if len(masked.Diff) > 0 {
+		masked.Diff = map[string]FieldChange{}
+		for key, change := range event.Event.Diff {
+			masked.Diff[key] = change
+		}
+		scope := &gorm.Scope{Value: record}
+		for _, name := range decision.Mask {
+			delete(masked.Diff, name)
+			if field, ok := lookupField(scope, name); ok {
+				delete(masked.Diff, strings.Split(GetStructTagJSON(field), ",")[0])
+			}
+		}
+	}
+	data, err := json.Marshal(&masked)
+	return data, err == nil, err
+}
@@ -0,0 +1,110 @@
+package grest_test
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+// TStreamEvents read data lines of events from the stream until n events are received,
+// ready is closed once the stream is subscribed if it is not nil
+func TStreamEvents(h *gresttest.Harness, path string, header http.Header, n int, ready chan<- struct{}) ([]string, error) {
+	req, err := http.NewRequest(http.MethodGet, h.Server.URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	resp, err := h.Server.Client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	// the response header is written after subscribing
+	if ready != nil {
+		close(ready)
+	}
+	var (
+		events []string
+		event  string
+	)
+	scanner := bufio.NewScanner(resp.Body)
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event += " " + strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			events = append(events, event)
+			event = ""
+		}
+	}
+	return events, scanner.Err()
+}
+
+// streamResult is result of TStreamEvents run in another goroutine
+type streamResult struct {
+	events []string
+	err    error
+}
+
+func TestStream(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	stream := grest.NewStream(2)
+	stream.Heartbeat = 10 * time.Millisecond
+	h.AddResource(&Doc{}, grest.ResourceConfig{Stream: stream})
+	h.AddResource(&MemoryUser{}, grest.ResourceConfig{View: TMemoryView(t), Stream: stream})
+
+	ready, done := make(chan struct{}), make(chan streamResult, 1)
+	go func() {
+		events, err := TStreamEvents(h, "/doc/stream?where="+url.QueryEscape(`["title = ?", "b"]`), nil, 1, ready)
+		done <- streamResult{events, err}
+	}()
+	select {
+	case <-ready:
+	case result := <-done:
+		t.Fatal(result.err)
+	}
+	doc := new(Doc)
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK).JSON(doc)
+	doc.Title = "b"
+	h.PUT("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	select {
+	case result := <-done:
+		if events := result.events; result.err != nil || len(events) != 1 || !strings.HasPrefix(events[0], "updated ") ||
+			!strings.Contains(events[0], `"b"`) {
+			t.Fatalf("unexpected events %v %v", events, result.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("stream timeout")
+	}
+
+	h.PUT("/memory_user").JSON(&MemoryUser{ID: 1, Name: "alice", Age: 31}).Expect().Status(http.StatusOK)
+	events, err := TStreamEvents(h, "/memory_user/stream", http.Header{"Last-Event-ID": {"2"}}, 1, nil)
+	if err != nil || len(events) != 1 || !strings.Contains(events[0], `"age":31`) {
+		t.Fatalf("unexpected replay %v %v", events, err)
+	}
+	events, err = TStreamEvents(h, "/doc/stream", http.Header{"Last-Event-ID": {"0"}}, 1, nil)
+	if err != nil || len(events) != 1 || !strings.HasPrefix(events[0], "updated ") {
+		t.Fatalf("unexpected replay %v %v", events, err)
+	}
+	h.DELETE("/doc").JSON(doc).Expect().Status(http.StatusOK)
+	events, err = TStreamEvents(h, "/doc/stream?lastEventId=1", nil, 2, nil)
+	if err != nil || len(events) != 2 || events[0] != "reset {}" || !strings.HasPrefix(events[1], "deleted ") {
+		t.Fatalf("unexpected reset %v %v", events, err)
+	}
+}
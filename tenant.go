@@ -0,0 +1,161 @@
+package grest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// TenantColumn is column of tenant id, models without the column are not scoped
+var TenantColumn = "tenant_id"
+
+var errTenantRequired = errors.New("tenant is required")
+
+// TenantResolver resolve tenant id of the request, empty string is no tenant
+type TenantResolver func(request *http.Request) string
+
+// HeaderTenant resolve tenant id from the request header, e.g. X-Tenant-ID
+func HeaderTenant(name string) TenantResolver {
+	return func(request *http.Request) string {
+		return strings.TrimSpace(request.Header.Get(name))
+	}
+}
+
+// ClaimTenant resolve tenant id from the claim of bearer JWT verified by the verifier,
+// tokens failing the verification resolve no tenant
+func ClaimTenant(verifier *JWTAuth, claim string) TenantResolver {
+	return func(request *http.Request) string {
+		token := bearerToken(request)
+		if token == "" {
+			return ""
+		}
+		claims, err := verifier.Verify(token)
+		if err != nil {
+			return ""
+		}
+		if value, ok := claims[claim]; ok && value != nil {
+			return fmt.Sprint(value)
+		}
+		return ""
+	}
+}
+
+// SubdomainTenant resolve tenant id from the subdomain of domain, e.g. acme of acme.example.com
+func SubdomainTenant(domain string) TenantResolver {
+	suffix := "." + strings.Trim(strings.ToLower(domain), ".")
+	return func(request *http.Request) string {
+		host := strings.ToLower(request.Host)
+		if i := strings.LastIndex(host, ":"); i >= 0 && !strings.HasSuffix(host, "]") {
+			host = host[:i]
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return ""
+		}
+		return strings.TrimSuffix(host, suffix)
+	}
+}
+
+// FirstTenant use the first tenant id resolved by the resolvers
+func FirstTenant(resolvers ...TenantResolver) TenantResolver {
+	return func(request *http.Request) string {
+		for _, resolver := range resolvers {
+			if tenant := resolver(request); tenant != "" {
+				return tenant
+			}
+		}
+		return ""
+	}
+}
+
+// Tenancy resolve tenant of the request into Context
+//
+//	api.Hooks = append(api.Hooks, grest.Tenancy{Resolver: grest.HeaderTenant("X-Tenant-ID"), Required: true}.Hook())
+type Tenancy struct {
+	Resolver TenantResolver
+	// Required reject the request without tenant, unless it is superuser
+	Required bool
+	// SuperUser is whether the request bypass the tenant scope
+	SuperUser func(cxt *Context) bool
+}
+
+// Hook is ContextHook of the tenancy
+func (t Tenancy) Hook() ContextHook {
+	return func(cxt *Context) error {
+		if t.SuperUser != nil && t.SuperUser(cxt) {
+			cxt.SuperUser = true
+		}
+		if t.Resolver != nil && cxt.Request != nil {
+			cxt.TenantID = t.Resolver(cxt.Request.Request)
+		}
+		if t.Required && cxt.TenantID == "" && !cxt.SuperUser {
+			return NewHTTPError(http.StatusBadRequest, errTenantRequired)
+		}
+		return nil
+	}
+}
+
+// tenantField get tenant field of the model
+func tenantField(scope *gorm.Scope) (*gorm.Field, bool) {
+	field, ok := scope.FieldByName(TenantColumn)
+	if !ok || field.IsIgnored {
+		return nil, false
+	}
+	return field, true
+}
+
+// scopeTenant add tenant condition of the model into db
+func scopeTenant(db *gorm.DB, value interface{}, context *Context) *gorm.DB {
+	if !context.TenantScoped() {
+		return db
+	}
+	scope := db.NewScope(value)
+	if field, ok := tenantField(scope); ok {
+		return db.Where(fmt.Sprintf("%v.%v = ?", scope.QuotedTableName(), scope.Quote(field.DBName)), context.TenantID)
+	}
+	return db
+}
+
+// stampTenant set tenant of context into the value, superuser only fill blank tenant
+func stampTenant(value interface{}, context *Context) error {
+	if context == nil || context.TenantID == "" {
+		return nil
+	}
+	scope := gorm.Scope{Value: value}
+	field, ok := tenantField(&scope)
+	if !ok || (context.SuperUser && !field.IsBlank) {
+		return nil
+	}
+	fieldType := field.Field.Type()
+	for fieldType.Kind() == reflect.Ptr {
+		fieldType = fieldType.Elem()
+	}
+	if fieldType.Kind() == reflect.String {
+		return field.Set(context.TenantID)
+	}
+	// numeric tenant id
+	return json.Unmarshal([]byte(context.TenantID), field.Field.Addr().Interface())
+}
+
+// tenantOf get tenant of the value as string
+func tenantOf(value interface{}) (string, bool) {
+	scope := gorm.Scope{Value: value}
+	field, ok := tenantField(&scope)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(normalizeValue(field.Field.Interface())), true
+}
+
+// matchTenant is whether the value belongs to tenant of context
+func matchTenant(value interface{}, context *Context) bool {
+	if !context.TenantScoped() {
+		return true
+	}
+	tenant, ok := tenantOf(value)
+	return !ok || tenant == context.TenantID
+}
@@ -0,0 +1,104 @@
+package grest_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type Note struct {
+	ID       uint   `json:"id" gorm:"primary_key"`
+	TenantID string `json:"tenantId"`
+	Title    string `json:"title"`
+}
+
+func TestTenancy(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	tenancy := grest.Tenancy{
+		Resolver: grest.HeaderTenant("X-Tenant-ID"),
+		Required: true,
+		SuperUser: func(cxt *grest.Context) bool {
+			return cxt.Request.HeaderParameter("X-Super-User") == "yes"
+		},
+	}
+	h.AddResource(&Note{}, grest.ResourceConfig{Hooks: []grest.ContextHook{tenancy.Hook()}})
+
+	a := new(Note)
+	h.POST("/note").Header("X-Tenant-ID", "a").JSON(&Note{Title: "a1", TenantID: "b"}).Expect().Status(http.StatusOK).JSON(a)
+	if a.TenantID != "a" {
+		t.Fatalf("tenant is not stamped %+v", a)
+	}
+	h.POST("/note").Header("X-Tenant-ID", "b").JSON(&Note{Title: "b1"}).Expect().Status(http.StatusOK)
+
+	h.GET("/note").Expect().Status(http.StatusBadRequest)
+	h.GET("/note").Header("X-Tenant-ID", "b").Expect().Status(http.StatusOK).Count(1)
+	h.GET("/note/"+"1").Header("X-Tenant-ID", "b").Expect().Status(http.StatusNotFound)
+	h.PUT("/note").Header("X-Tenant-ID", "b").JSON(&Note{ID: a.ID, Title: "stolen"}).Expect().Status(http.StatusNotFound)
+	h.DELETE("/note").Header("X-Tenant-ID", "b").JSON(a).Expect().Status(http.StatusNotFound)
+	h.GET("/note/1").Header("X-Tenant-ID", "a").Expect().Status(http.StatusOK).Contains(`"a1"`)
+	h.GET("/note").Header("X-Super-User", "yes").Expect().Status(http.StatusOK).Count(2)
+
+	// the condition can not escape its group to OR with the tenant scope
+	for _, where := range []string{"1=1) OR (1=1", "1=1)) OR ((1=1", "1=1; DELETE FROM notes", "1=1 -- ", "title = ')'"} {
+		status := http.StatusBadRequest
+		if where == "title = ')'" {
+			status = http.StatusOK
+		}
+		h.GET("/note").Header("X-Tenant-ID", "b").Filter(&grest.Filter{Where: []interface{}{where}}).Expect().Status(status)
+	}
+	h.GET("/note").Header("X-Tenant-ID", "b").Filter(&grest.Filter{Where: []interface{}{"(title = ? OR title = ?)", "a1", "b1"}}).
+		Expect().Status(http.StatusOK).Count(1)
+
+	// fields, order and groups are column names, joins can not read rows of other tenants
+	for _, filter := range []*grest.Filter{
+		{Fields: []string{"n2.id", "n2.tenant_id", "n2.title"}, Joins: []string{"JOIN notes n2 ON 1=1"}},
+		{Joins: []string{"JOIN notes n2 ON 1=1"}},
+		{Fields: []string{"id", "tenant_id", "(select group_concat(title) from notes) as title"}},
+		{Fields: []string{"id", "title as tenant_id"}},
+		{Order: "(select title from notes limit 1)"},
+		{Order: "title desc, id; drop table notes"},
+		{Groups: []string{"title, (select 1)"}},
+	} {
+		h.GET("/note").Header("X-Tenant-ID", "b").Filter(filter).Expect().Status(http.StatusBadRequest).Error(http.StatusBadRequest)
+	}
+	h.GET("/note").Header("X-Tenant-ID", "b").Filter(&grest.Filter{Fields: []string{"id", "title"}, Order: "title DESC, id"}).
+		Expect().Status(http.StatusOK).Count(1).Contains(`"b1"`)
+}
+
+func TestTenantResolver(t *testing.T) {
+	secret := []byte("secret")
+	hs256 := func(b []byte) []byte {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(b)
+		return mac.Sum(nil)
+	}
+	verifier := &grest.JWTAuth{Secret: secret}
+	exp := time.Now().Add(time.Hour).Unix()
+	request := httptest.NewRequest(http.MethodGet, "http://acme.example.com:8080/note", nil)
+	request.Header.Set("Authorization", "Bearer "+TToken(t, "HS256", "", map[string]interface{}{"sub": "1", "tenant": 42, "exp": exp}, hs256))
+
+	if tenant := grest.SubdomainTenant("example.com")(request); tenant != "acme" {
+		t.Fatalf("unexpected subdomain tenant %q", tenant)
+	}
+	if tenant := grest.ClaimTenant(verifier, "tenant")(request); tenant != "42" {
+		t.Fatalf("unexpected claim tenant %q", tenant)
+	}
+	if tenant := grest.FirstTenant(grest.HeaderTenant("X-Tenant-ID"), grest.ClaimTenant(verifier, "tenant"))(request); tenant != "42" {
+		t.Fatalf("unexpected tenant %q", tenant)
+	}
+
+	// the claim of an unverified token is not trusted
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","tenant":42}`))
+	request.Header.Set("Authorization", "Bearer e30."+payload+".sig")
+	if tenant := grest.ClaimTenant(verifier, "tenant")(request); tenant != "" {
+		t.Fatalf("unexpected tenant %q of forged token", tenant)
+	}
+}
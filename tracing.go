@@ -0,0 +1,232 @@
+package grest
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/emicklei/go-restful"
+	"github.com/jinzhu/gorm"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is instrumentation name of grest spans
+const TracerName = "github.com/zhgqiang/grest"
+
+// Span attributes of grest
+const (
+	AttrResource    = attribute.Key("grest.resource")
+	AttrAction      = attribute.Key("grest.action")
+	AttrFilterShape = attribute.Key("grest.filter.shape")
+	AttrRows        = attribute.Key("grest.rows")
+	AttrCount       = attribute.Key("grest.count")
+)
+
+// spanContextKey is db setting carrying context of spans into gorm callbacks, spanKey is SQL span of the scope
+const (
+	spanContextKey = "grest:span_context"
+	spanKey        = "grest:span"
+)
+
+// Tracing is OpenTelemetry tracing of requests, it starts the server span from W3C trace context headers,
+// handlers, APIView methods and SQL statements of instrumented db are traced as its children
+//
+//	tracing := grest.NewTracing(provider)
+//	tracing.Instrument(db)
+//	api.Container.Filter(tracing.Filter)
+type Tracing struct {
+	Provider   trace.TracerProvider
+	Propagator propagation.TextMapPropagator
+}
+
+// NewTracing is create Tracing of the provider, default is the global provider
+func NewTracing(provider trace.TracerProvider) *Tracing {
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracing{
+		Provider:   provider,
+		Propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}
+}
+
+// Filter is restful filter starting the server span, use it as container filter
+func (t *Tracing) Filter(request *restful.Request, response *restful.Response, chain *restful.FilterChain) {
+	route := selectedRoute(request)
+	if route == nil {
+		chain.ProcessFilter(request, response)
+		return
+	}
+	resource, action := routeLabels(route)
+	ctx, span := t.start(request.Request, request.Request.Method+" "+route.Path(),
+		AttrResource.String(resource), AttrAction.String(action), attribute.String("http.route", route.Path()))
+	defer span.End()
+	request.Request = request.Request.WithContext(ctx)
+	chain.ProcessFilter(request, response)
+	endHTTPSpan(span, response.StatusCode())
+}
+
+// Middleware is net/http middleware starting the server span, e.g. for GenericAPIView.HTTPHandler
+func (t *Tracing) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := t.start(r, r.Method+" "+r.URL.Path)
+		defer span.End()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+		endHTTPSpan(span, recorder.status)
+	})
+}
+
+// Instrument trace SQL statements of the db, statements out of traced requests are not traced
+func (t *Tracing) Instrument(db *gorm.DB) {
+	registerCallbacks(db, "grest:tracing", func(scope *gorm.Scope, operation string) {
+		value, ok := scope.Get(spanContextKey)
+		if !ok {
+			return
+		}
+		ctx, _ := value.(context.Context)
+		if ctx == nil || !trace.SpanFromContext(ctx).IsRecording() {
+			return
+		}
+		_, span := tracer(ctx).Start(ctx, "gorm."+operation, trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(AttrResource.String(scopeResource(scope)), attribute.String("db.sql.table", scope.TableName()),
+				attribute.String("db.system", scope.Dialect().GetName())))
+		scope.InstanceSet(spanKey, span)
+	}, func(scope *gorm.Scope, operation string, start time.Time) {
+		value, ok := scope.InstanceGet(spanKey)
+		if !ok {
+			return
+		}
+		span := value.(trace.Span)
+		span.SetAttributes(attribute.String("db.statement", scope.SQL), AttrRows.Int64(scope.DB().RowsAffected))
+		if err := scope.DB().Error; err != nil && err != gorm.ErrRecordNotFound {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	})
+}
+
+// start extract the trace context of the request and start the server span
+func (t *Tracing) start(r *http.Request, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx := t.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	attrs = append(attrs, attribute.String("http.request.method", r.Method), attribute.String("url.path", r.URL.Path))
+	return t.Provider.Tracer(TracerName).Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+}
+
+// endHTTPSpan record the response status
+func endHTTPSpan(span trace.Span, status int) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+}
+
+// statusRecorder record status of the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader record the status
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush flush the response if supported, e.g. for Stream
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// SpanContext is context of spans of the context, the request context by default
+func (cxt *Context) SpanContext() context.Context {
+	if cxt.spanContext != nil {
+		return cxt.spanContext
+	}
+	if cxt.Request != nil && cxt.Request.Request != nil {
+		return cxt.Request.Request.Context()
+	}
+	return context.Background()
+}
+
+// tracer is tracer of the provider of the span in ctx, spans are not recorded out of traced requests
+func tracer(ctx context.Context) trace.Tracer {
+	return trace.SpanFromContext(ctx).TracerProvider().Tracer(TracerName)
+}
+
+// startSpan start child span of the context, the returned context carries the span
+func startSpan(cxt *Context, name string, attrs ...attribute.KeyValue) (*Context, trace.Span) {
+	if cxt == nil {
+		return cxt, trace.SpanFromContext(context.Background())
+	}
+	parent := cxt.SpanContext()
+	if !trace.SpanFromContext(parent).IsRecording() {
+		return cxt, trace.SpanFromContext(parent)
+	}
+	ctx, span := tracer(parent).Start(parent, name, trace.WithAttributes(attrs...))
+	cxt = cxt.Clone()
+	cxt.spanContext = ctx
+	return cxt, span
+}
+
+// endSpan record the error and end the span
+func endSpan(span trace.Span, err error, attrs ...attribute.KeyValue) {
+	span.SetAttributes(attrs...)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setSpanAttributes set attributes of the current span of the context
+func setSpanAttributes(cxt *Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(cxt.SpanContext()).SetAttributes(attrs...)
+}
+
+// traceDB put context of spans into the db for SQL spans, see Tracing.Instrument
+func traceDB(db *gorm.DB, cxt *Context) *gorm.DB {
+	if db == nil || cxt == nil || cxt.spanContext == nil {
+		return db
+	}
+	return db.Set(spanContextKey, cxt.spanContext)
+}
+
+// traceHandler run the handler in span of the action
+func (g *GenericAPIView) traceHandler(cxt *Context, action Action, handler func(cxt *Context) *Result) *Result {
+	cxt, span := startSpan(cxt, ModelType(g.Value).Name()+" "+string(action),
+		AttrResource.String(ModelType(g.Value).Name()), AttrAction.String(string(action)))
+	result := handler(cxt)
+	if result == nil {
+		span.End()
+		return result
+	}
+	span.SetAttributes(attribute.Int("grest.status", result.Status))
+	if result.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(result.Status))
+	}
+	span.End()
+	return result
+}
+
+// resourceAttr is resource attribute of the result
+func resourceAttr(result interface{}) attribute.KeyValue {
+	return AttrResource.String(ModelType(result).Name())
+}
+
+// rowsOf is length of the result slice, 1 for a struct
+func rowsOf(result interface{}) int {
+	rv := reflect.Indirect(reflect.ValueOf(result))
+	if rv.Kind() == reflect.Slice {
+		return rv.Len()
+	}
+	return 1
+}
@@ -0,0 +1,129 @@
+package grest_test
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector is OTLP/HTTP collector stand-in keeping received spans
+type collector struct {
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, _ := io.ReadAll(r.Body)
+	req := &collectortrace.ExportTraceServiceRequest{}
+	if err := proto.Unmarshal(b, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	for _, resource := range req.ResourceSpans {
+		for _, scope := range resource.ScopeSpans {
+			c.spans = append(c.spans, scope.Spans...)
+		}
+	}
+	c.mu.Unlock()
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	b, _ = proto.Marshal(&collectortrace.ExportTraceServiceResponse{})
+	w.Write(b)
+}
+
+func (c *collector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// the last one, queries of count are before the query of data
+	for i := len(c.spans) - 1; i >= 0; i-- {
+		if c.spans[i].Name == name {
+			return c.spans[i]
+		}
+	}
+	return nil
+}
+
+func spanAttr(span *tracepb.Span, key string) string {
+	for _, attr := range span.Attributes {
+		if attr.Key == key {
+			if attr.Value.GetStringValue() != "" {
+				return attr.Value.GetStringValue()
+			}
+			return fmt.Sprint(attr.Value.GetIntValue())
+		}
+	}
+	return ""
+}
+
+func TestTracing(t *testing.T) {
+	c := &collector{}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+	exporter, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(srv.URL+"/v1/traces"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer provider.Shutdown(context.Background())
+
+	h := gresttest.New(t)
+	defer h.Close()
+	tracing := grest.NewTracing(provider)
+	tracing.Instrument(h.DB)
+	h.Container.Filter(tracing.Filter)
+	h.AddResource(&Doc{})
+
+	h.POST("/doc").JSON(&Doc{Title: "a"}).Expect().Status(http.StatusOK)
+	traceID := "4bf92f3577b34da6a3ce929d0e0e4736"
+	h.GET("/doc").Header("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01").
+		Filter(&grest.Filter{Where: []interface{}{"title = ?", "a"}}).Expect().Status(http.StatusOK).Count(1)
+
+	server := c.span("GET /doc/")
+	if server == nil {
+		t.Fatal("expected server span")
+	}
+	if got := hex.EncodeToString(server.TraceId); got != traceID {
+		t.Fatalf("expected trace id %s, got %s", traceID, got)
+	}
+	parents := map[string]string{
+		"Doc list":         "GET /doc/",
+		"APIView.FindMany": "Doc list",
+		"APIView.Count":    "APIView.FindMany",
+		"gorm.query":       "APIView.FindMany",
+	}
+	for name, parent := range parents {
+		span, p := c.span(name), c.span(parent)
+		if span == nil || p == nil {
+			t.Fatalf("expected span %s with parent %s", name, parent)
+		}
+		if string(span.TraceId) != string(server.TraceId) || string(span.ParentSpanId) != string(p.SpanId) {
+			t.Fatalf("expected span %s child of %s", name, parent)
+		}
+	}
+	if shape := spanAttr(c.span("Doc list"), "grest.filter.shape"); shape != `{"where":"title = ?"}` {
+		t.Fatalf("unexpected filter shape %s", shape)
+	}
+	if rows := spanAttr(c.span("APIView.FindMany"), "grest.rows"); rows != "1" {
+		t.Fatalf("unexpected rows %s", rows)
+	}
+	if statement := spanAttr(c.span("gorm.query"), "db.statement"); !strings.Contains(statement, "SELECT") {
+		t.Fatalf("unexpected statement %s", statement)
+	}
+	if c.span("POST /doc/") == nil || c.span("gorm.create") == nil {
+		t.Fatal("expected spans of create")
+	}
+}
@@ -1,5 +1,11 @@
 package grest
 
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
 // Filter is Query Conditions
 type Filter struct {
 	Fields    []string      `json:"fields"`
@@ -11,4 +17,50 @@ type Filter struct {
 	Preloads  []string      `json:"preloads"`
 	Offset    int           `json:"offset"`
 	Limit     int           `json:"limit"`
+	// AsOf query the state at the time, the resource must keep History
+	AsOf *time.Time `json:"asOf,omitempty"`
+}
+
+// FilterShape is the filter without values of its where condition, filters of the same query share the shape
+//
+//	{"where":["name = ? and age > ?","a",1]} -> {"where":"name = ? and age > ?"}
+//	{"where":[{"name":"a"}]}                 -> {"where":["name"]}
+func FilterShape(filter *Filter) string {
+	if filter == nil {
+		return "{}"
+	}
+	normal := normalizeFilter(filter)
+	shape := struct {
+		Fields   []string    `json:"fields,omitempty"`
+		Where    interface{} `json:"where,omitempty"`
+		Order    string      `json:"order,omitempty"`
+		Joins    []string    `json:"joins,omitempty"`
+		Groups   []string    `json:"groups,omitempty"`
+		Preloads []string    `json:"preloads,omitempty"`
+		Paged    bool        `json:"paged,omitempty"`
+		AsOf     bool        `json:"asOf,omitempty"`
+	}{
+		Fields:   normal.Fields,
+		Order:    normal.Order,
+		Joins:    normal.Joins,
+		Groups:   normal.Groups,
+		Preloads: normal.Preloads,
+		Paged:    normal.Limit != 0,
+		AsOf:     normal.AsOf != nil,
+	}
+	if len(normal.Where) > 0 {
+		switch cond := normal.Where[0].(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(cond))
+			for key := range cond {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			shape.Where = keys
+		default:
+			shape.Where = cond
+		}
+	}
+	b, _ := json.Marshal(shape)
+	return string(b)
 }
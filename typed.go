@@ -0,0 +1,120 @@
+package grest
+
+import "reflect"
+
+// model create values of a resource model for the handlers of GenericAPIView,
+// Repository creates them with its type parameter, reflectModel adapts a value known at runtime
+type model interface {
+	newOne() interface{}
+	newSlice() interface{}
+}
+
+// reflectModel is model of the value by reflection, it is used by GenericAPIView.Init
+type reflectModel struct {
+	value interface{}
+}
+
+// newOne initialize a struct pointer of the value
+func (m reflectModel) newOne() interface{} {
+	return reflect.New(Indirect(reflect.ValueOf(m.value)).Type()).Interface()
+}
+
+// newSlice initialize a slice pointer of the value type
+func (m reflectModel) newSlice() interface{} {
+	sliceType := reflect.SliceOf(reflect.TypeOf(m.value))
+	slicePtr := reflect.New(sliceType)
+	slicePtr.Elem().Set(reflect.MakeSlice(sliceType, 0, 0))
+	return slicePtr.Interface()
+}
+
+// Repository is type parameterised data access of T, it is the model of TypedAPIView handlers
+type Repository[T any] struct {
+	view View
+}
+
+// NewRepository is create Repository of T on the view, APIView is used if view is nil
+//
+//	users := grest.NewRepository[User](nil)
+//	list, count, err := users.FindMany(cxt, &grest.Filter{Limit: 10})
+func NewRepository[T any](view View) *Repository[T] {
+	if view == nil {
+		view = new(APIView)
+	}
+	return &Repository[T]{view: view}
+}
+
+// View is data access of the repository
+func (r *Repository[T]) View() View {
+	return r.view
+}
+
+// FindMany query data by the filter, count is the total count of the filtered data
+func (r *Repository[T]) FindMany(cxt *Context, filter *Filter) ([]T, int, error) {
+	results := make([]T, 0)
+	count, err := r.view.FindMany(&results, filter, cxt)
+	if err != nil {
+		return nil, 0, err
+	}
+	return results, count, nil
+}
+
+// FindOne query data by the primary key, multiple primary values are joined with a comma
+func (r *Repository[T]) FindOne(cxt *Context, id string) (*T, error) {
+	cxt = cxt.Clone()
+	cxt.ResourceID = id
+	result := new(T)
+	if err := r.view.FindOne(result, cxt); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Save create or update the data
+func (r *Repository[T]) Save(cxt *Context, value *T) error {
+	return r.view.Save(value, cxt)
+}
+
+// Delete delete the data
+func (r *Repository[T]) Delete(cxt *Context, value *T) error {
+	return r.view.Delete(value, cxt)
+}
+
+// newOne initialize *T
+func (r *Repository[T]) newOne() interface{} {
+	return new(T)
+}
+
+// newSlice initialize *[]T
+func (r *Repository[T]) newSlice() interface{} {
+	results := make([]T, 0)
+	return &results
+}
+
+// TypedAPIView is type parameterised GenericAPIView, its handlers create T and []T by the Repository without reflection
+type TypedAPIView[T any] struct {
+	*GenericAPIView
+	Repository *Repository[T]
+}
+
+// NewResource is create TypedAPIView of T, APIView is used if view is not given
+//
+//	users := grest.NewResource[User](cxt)
+//	users.WebService("user")
+func NewResource[T any](cxt *Context, view ...View) *TypedAPIView[T] {
+	g := new(GenericAPIView)
+	if len(view) > 0 {
+		g.View = view[0]
+	}
+	repository := NewRepository[T](g.view())
+	g.init(cxt, new(T), repository)
+	return &TypedAPIView[T]{GenericAPIView: g, Repository: repository}
+}
+
+// AddTypedResource register T into API and its container, see API.AddResource
+func AddTypedResource[T any](api *API, configs ...ResourceConfig) (*Resource, error) {
+	var view []View
+	if len(configs) > 0 && configs[0].View != nil {
+		view = append(view, configs[0].View)
+	}
+	return api.mount(NewResource[T](api.Context, view...).GenericAPIView, configs...)
+}
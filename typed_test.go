@@ -0,0 +1,130 @@
+package grest_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+// fakeView is View double serving fixed docs, it fails if the handlers do not create Doc and []Doc
+type fakeView struct {
+	docs    []Doc
+	saved   []Doc
+	deleted []Doc
+	ids     []string
+}
+
+func (f *fakeView) FindMany(results interface{}, filter *grest.Filter, cxt *grest.Context) (int, error) {
+	docs, ok := results.(*[]Doc)
+	if !ok {
+		return 0, errors.New("results are not *[]Doc")
+	}
+	*docs = append(*docs, f.docs...)
+	return len(f.docs), nil
+}
+
+func (f *fakeView) FindOne(result interface{}, cxt *grest.Context) error {
+	doc, ok := result.(*Doc)
+	if !ok {
+		return errors.New("result is not *Doc")
+	}
+	f.ids = append(f.ids, cxt.ResourceID)
+	for _, each := range f.docs {
+		if cxt.ResourceID == "1" && each.ID == 1 {
+			*doc = each
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (f *fakeView) Save(value interface{}, cxt *grest.Context) error {
+	doc, ok := value.(*Doc)
+	if !ok {
+		return errors.New("value is not *Doc")
+	}
+	doc.ID = uint(len(f.docs) + 1)
+	f.saved = append(f.saved, *doc)
+	return nil
+}
+
+func (f *fakeView) Delete(value interface{}, cxt *grest.Context) error {
+	doc, ok := value.(*Doc)
+	if !ok {
+		return errors.New("value is not *Doc")
+	}
+	f.deleted = append(f.deleted, *doc)
+	return nil
+}
+
+func TestRepository(t *testing.T) {
+	view := &fakeView{docs: []Doc{{ID: 1, Title: "t1"}, {ID: 2, Title: "t2"}}}
+	docs := grest.NewRepository[Doc](view)
+	cxt := new(grest.Context)
+
+	list, count, err := docs.FindMany(cxt, &grest.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 || len(list) != 2 || list[1].Title != "t2" {
+		t.Fatalf("unexpected docs %d %+v", count, list)
+	}
+	doc, err := docs.FindOne(cxt, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.Title != "t1" || cxt.ResourceID != "" {
+		t.Fatalf("unexpected doc %+v of context %+v", doc, cxt)
+	}
+	if _, err := docs.FindOne(cxt, "9"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("expected record not found, got %v", err)
+	}
+	created := &Doc{Title: "t3"}
+	if err := docs.Save(cxt, created); err != nil {
+		t.Fatal(err)
+	}
+	if err := docs.Delete(cxt, created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ID != 3 || len(view.saved) != 1 || len(view.deleted) != 1 {
+		t.Fatalf("unexpected writes %+v %+v", view.saved, view.deleted)
+	}
+	if _, ok := grest.NewRepository[Doc](nil).View().(*grest.APIView); !ok {
+		t.Fatal("expected APIView of nil view")
+	}
+}
+
+func TestTypedResource(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	view := &fakeView{docs: []Doc{{ID: 1, Title: "t1"}}}
+	res, err := grest.AddTypedResource[Doc](h.API, grest.ResourceConfig{View: view})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.View.NewSlice.(*[]Doc); !ok {
+		t.Fatalf("unexpected NewSlice %T", res.View.NewSlice)
+	}
+
+	h.GET("/doc").Expect().Status(http.StatusOK).Count(1).Contains(`"t1"`)
+	h.GET("/doc/1").Expect().Status(http.StatusOK).Contains(`"t1"`)
+	h.GET("/doc/9").Expect().Status(http.StatusNotFound)
+	h.POST("/doc").JSON(&Doc{Title: "t2"}).Expect().Status(http.StatusOK).Contains(`"id": 2`)
+	if len(view.saved) != 1 || view.saved[0].Title != "t2" {
+		t.Fatalf("unexpected saved docs %+v", view.saved)
+	}
+
+	// the reflective view creates *Doc and *[]*Doc
+	reflective := new(grest.GenericAPIView)
+	reflective.Init(nil, &Doc{})
+	if _, ok := reflective.NewSlice.(*[]*Doc); !ok {
+		t.Fatalf("unexpected NewSlice %T", reflective.NewSlice)
+	}
+	if _, ok := reflective.NewStruct.(*Doc); !ok {
+		t.Fatalf("unexpected NewStruct %T", reflective.NewStruct)
+	}
+}
@@ -0,0 +1,469 @@
+package grest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+var errUpsertUnsupported = NewHTTPError(http.StatusNotImplemented, errors.New("upsert is not supported by the view"))
+
+// Upserter is View inserting data, or updating the rows having the same values of conflict columns
+// update are columns updated on conflict, default is all columns except primary key, conflict columns, tenant column and created_at
+type Upserter interface {
+	Upsert(result interface{}, conflict []string, update []string, context *Context) error
+}
+
+var (
+	_ Upserter = (*APIView)(nil)
+	_ Upserter = (*CachedView)(nil)
+)
+
+// UpsertBatchSize is max rows of one INSERT statement of Upsert
+var UpsertBatchSize = 100
+
+// Upsert insert or update data of struct or slice pointer by conflict columns in one transaction,
+// conflict columns must have a unique index, result is filled with the stored rows.
+// Rows are inserted by one statement per batch, the tenant column is never updated, and the row of
+// another tenant is not updated on conflict
+//
+//	INSERT ... ON CONFLICT (email) DO UPDATE SET name = excluded.name WHERE users.tenant_id = excluded.tenant_id  -- postgres, sqlite3
+//	INSERT ... ON DUPLICATE KEY UPDATE name = VALUES(name)                                                       -- mysql
+func (p *APIView) Upsert(result interface{}, conflict []string, update []string, context *Context) (err error) {
+	context, span := startSpan(context, "APIView.Upsert", resourceAttr(result))
+	defer func() { endSpan(span, err, AttrRows.Int(rowsOf(result))) }()
+	db := traceDB(context.GetDB(), context)
+	if db == nil {
+		return errors.New("db is nil")
+	}
+	items := upsertItems(result)
+	if len(items) == 0 {
+		return nil
+	}
+	scope := db.NewScope(items[0])
+	conflict, update, err = upsertColumns(scope, conflict, update)
+	if err != nil {
+		return err
+	}
+	option, err := upsertOption(scope, conflict, update)
+	if err != nil {
+		return err
+	}
+	changes := make([]*Change, 0, len(items))
+	err = transaction(db, func(tx *gorm.DB) error {
+		batches, err := upsertBatches(tx, items, conflict, context)
+		if err != nil {
+			return err
+		}
+		for _, batch := range batches {
+			batchChanges, err := batch.upsert(tx, option, context)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, batchChanges...)
+		}
+		return runWriteHooks(tx, changes...)
+	})
+	if err != nil {
+		return err
+	}
+	runCommitHooks(changes...)
+	return nil
+}
+
+// Upsert upsert data by the view and invalidate the resource
+func (c *CachedView) Upsert(result interface{}, conflict []string, update []string, context *Context) error {
+	upserter, ok := c.View.(Upserter)
+	if !ok {
+		return errUpsertUnsupported
+	}
+	defer c.Cache.Invalidate(ModelType(result).Name())
+	return upserter.Upsert(result, conflict, update, context)
+}
+
+// upsertItems is struct pointers of the struct or slice pointer
+func upsertItems(result interface{}) []interface{} {
+	rv := Indirect(reflect.ValueOf(result))
+	if rv.Kind() != reflect.Slice {
+		return []interface{}{result}
+	}
+	items := make([]interface{}, 0, rv.Len())
+	for i := 0; i < rv.Len(); i++ {
+		item := rv.Index(i)
+		if item.Kind() != reflect.Ptr {
+			item = item.Addr()
+		}
+		items = append(items, item.Interface())
+	}
+	return items
+}
+
+// upsertBatch is items inserted by one statement, the items have the same columns and distinct conflict keys
+type upsertBatch struct {
+	items    []interface{}
+	keys     []string
+	columns  []string
+	conflict []string
+}
+
+// upsertBatches prepare the items as Create does, and split them into batches
+func upsertBatches(tx *gorm.DB, items []interface{}, conflict []string, context *Context) ([]*upsertBatch, error) {
+	var batches []*upsertBatch
+	var last *upsertBatch
+	now := gorm.NowFunc()
+	for _, item := range items {
+		if err := stampTenant(item, context); err != nil {
+			return nil, err
+		}
+		scope := tx.NewScope(item)
+		for _, method := range []string{"BeforeSave", "BeforeCreate"} {
+			if scope.CallMethod(method); scope.HasError() {
+				return nil, scope.DB().Error
+			}
+		}
+		for _, name := range []string{"CreatedAt", "UpdatedAt"} {
+			if field, ok := scope.FieldByName(name); ok && field.IsBlank {
+				if err := field.Set(now); err != nil {
+					return nil, err
+				}
+			}
+		}
+		columns := insertColumns(scope)
+		key := conflictKey(scope, conflict)
+		if last == nil || len(last.items) >= UpsertBatchSize || strings.Join(last.columns, ",") != strings.Join(columns, ",") ||
+			containsString(last.keys, key) {
+			last = &upsertBatch{columns: columns, conflict: conflict}
+			batches = append(batches, last)
+		}
+		last.items = append(last.items, item)
+		last.keys = append(last.keys, key)
+	}
+	return batches, nil
+}
+
+// upsert insert the batch by one statement, the existing and stored rows are read by conflict columns
+func (b *upsertBatch) upsert(tx *gorm.DB, option string, context *Context) ([]*Change, error) {
+	existing, err := b.find(tx)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]*Change, len(b.items))
+	for i, item := range b.items {
+		changes[i] = newChange(ActionCreate, item, context)
+		if before, ok := existing[b.keys[i]]; ok {
+			// the row out of scopes is reported as not found, as Save does
+			if ok, err := matchScopes(before, context); err != nil {
+				return nil, err
+			} else if !ok {
+				return nil, gorm.ErrRecordNotFound
+			}
+			changes[i].Action = ActionUpdate
+			changes[i].Before = before
+		}
+	}
+
+	scope := tx.NewScope(b.items[0])
+	statement, vars := b.statement(scope, option)
+	var stored map[string]interface{}
+	if scope.Dialect().GetName() == "postgres" && !strings.HasSuffix(option, "DO NOTHING") {
+		rows := reflect.New(reflect.SliceOf(reflect.PtrTo(ModelType(b.items[0]))))
+		if err := tx.Raw(statement+" RETURNING *", vars...).Scan(rows.Interface()).Error; err != nil {
+			return nil, err
+		}
+		stored = b.index(tx, rows.Elem())
+	} else {
+		if err := tx.Exec(statement, vars...).Error; err != nil {
+			return nil, err
+		}
+		// primary key is not returned on conflict by all dialects, read the stored rows
+		if stored, err = b.find(tx); err != nil {
+			return nil, err
+		}
+	}
+	for i, item := range b.items {
+		row, ok := stored[b.keys[i]]
+		if !ok {
+			return nil, gorm.ErrRecordNotFound
+		}
+		// the row of another tenant inserted concurrently is not updated, or is rolled back for mysql
+		if ok, err := matchScopes(row, context); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, gorm.ErrRecordNotFound
+		}
+		reflect.ValueOf(item).Elem().Set(reflect.ValueOf(row).Elem())
+		scope := tx.NewScope(item)
+		for _, method := range []string{"AfterCreate", "AfterSave"} {
+			if scope.CallMethod(method); scope.HasError() {
+				return nil, scope.DB().Error
+			}
+		}
+		changes[i].After = copyValue(item)
+	}
+	return changes, nil
+}
+
+// statement is INSERT statement of the batch with the option
+func (b *upsertBatch) statement(scope *gorm.Scope, option string) (string, []interface{}) {
+	columns := make([]string, len(b.columns))
+	placeholders := make([]string, len(b.columns))
+	for i, column := range b.columns {
+		columns[i] = scope.Quote(column)
+		placeholders[i] = "?"
+	}
+	row := "(" + strings.Join(placeholders, ", ") + ")"
+	rows := make([]string, len(b.items))
+	vars := make([]interface{}, 0, len(b.items)*len(b.columns))
+	for i, item := range b.items {
+		rows[i] = row
+		vars = append(vars, columnValues(scope.New(item), b.columns)...)
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s %s",
+		scope.QuotedTableName(), strings.Join(columns, ", "), strings.Join(rows, ", "), option), vars
+}
+
+// find read rows having the conflict keys of the batch by one query
+func (b *upsertBatch) find(tx *gorm.DB) (map[string]interface{}, error) {
+	scope := tx.NewScope(b.items[0])
+	conditions := make([]string, len(b.conflict))
+	for i, column := range b.conflict {
+		conditions[i] = scope.Quote(column) + " = ?"
+	}
+	condition := "(" + strings.Join(conditions, " AND ") + ")"
+	where := make([]string, len(b.items))
+	vars := make([]interface{}, 0, len(b.items)*len(b.conflict))
+	for i, item := range b.items {
+		where[i] = condition
+		vars = append(vars, columnValues(scope.New(item), b.conflict)...)
+	}
+	rows := reflect.New(reflect.SliceOf(reflect.PtrTo(ModelType(b.items[0]))))
+	if err := tx.Unscoped().Where(strings.Join(where, " OR "), vars...).Find(rows.Interface()).Error; err != nil {
+		return nil, err
+	}
+	return b.index(tx, rows.Elem()), nil
+}
+
+// index map rows by their conflict keys
+func (b *upsertBatch) index(tx *gorm.DB, rows reflect.Value) map[string]interface{} {
+	indexed := make(map[string]interface{}, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		row := rows.Index(i).Interface()
+		indexed[conflictKey(tx.NewScope(row), b.conflict)] = row
+	}
+	return indexed
+}
+
+// insertColumns is columns inserted by Create, blank primary key and blank fields having default value are omitted
+func insertColumns(scope *gorm.Scope) []string {
+	var columns []string
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || (field.IsBlank && (field.IsPrimaryKey || field.HasDefaultValue)) {
+			continue
+		}
+		columns = append(columns, field.DBName)
+	}
+	return columns
+}
+
+// columnValues is values of the columns of the scope value
+func columnValues(scope *gorm.Scope, columns []string) []interface{} {
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		field, _ := scope.FieldByName(column)
+		values[i] = field.Field.Interface()
+	}
+	return values
+}
+
+// conflictKey is the key of values of conflict columns
+func conflictKey(scope *gorm.Scope, conflict []string) string {
+	values := columnValues(scope, conflict)
+	keys := make([]string, len(values))
+	for i, value := range values {
+		keys[i] = fmt.Sprint(normalizeValue(value))
+	}
+	return strings.Join(keys, "\x00")
+}
+
+// upsertColumns resolve conflict and update columns by struct name, column or json name
+func upsertColumns(scope *gorm.Scope, conflict []string, update []string) ([]string, []string, error) {
+	if len(conflict) == 0 {
+		return nil, nil, NewHTTPError(http.StatusBadRequest, errors.New("conflict columns are required"))
+	}
+	resolve := func(names []string) ([]string, error) {
+		columns := make([]string, 0, len(names))
+		for _, name := range names {
+			field, ok := lookupField(scope, name)
+			if !ok || !field.IsNormal || field.IsIgnored {
+				return nil, NewHTTPError(http.StatusBadRequest, fmt.Errorf("unknown column %s", name))
+			}
+			columns = append(columns, field.DBName)
+		}
+		return columns, nil
+	}
+	conflict, err := resolve(conflict)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the row never moves to another tenant
+	tenant := ""
+	if field, ok := tenantField(scope); ok {
+		tenant = field.DBName
+	}
+	if len(update) > 0 {
+		if update, err = resolve(update); err == nil && tenant != "" && containsString(update, tenant) {
+			err = NewHTTPError(http.StatusBadRequest, fmt.Errorf("column %s can not be updated", tenant))
+		}
+		return conflict, update, err
+	}
+	for _, field := range scope.Fields() {
+		if !field.IsNormal || field.IsIgnored || field.IsPrimaryKey || field.DBName == "created_at" || field.DBName == tenant ||
+			containsString(conflict, field.DBName) {
+			continue
+		}
+		update = append(update, field.DBName)
+	}
+	return conflict, update, nil
+}
+
+// forbidUpdate reject update columns naming forbidden fields, and drop forbidden fields from the default update columns.
+// Conflict columns, updated to the same values, are the update columns if no column is left
+func forbidUpdate(scope *gorm.Scope, conflict []string, update []string, forbid []string) ([]string, error) {
+	if len(forbid) == 0 {
+		return update, nil
+	}
+	conflictColumns, updateColumns, err := upsertColumns(scope, conflict, update)
+	if err != nil {
+		return nil, err
+	}
+	forbidden := make([]string, 0, len(forbid))
+	for _, name := range forbid {
+		if field, ok := lookupField(scope, name); ok {
+			forbidden = append(forbidden, field.DBName)
+		}
+	}
+	columns := make([]string, 0, len(updateColumns))
+	for _, column := range updateColumns {
+		if !containsString(forbidden, column) {
+			columns = append(columns, column)
+		} else if len(update) > 0 {
+			return nil, NewHTTPError(http.StatusBadRequest, fmt.Errorf("column %s is forbidden", column))
+		}
+	}
+	if len(columns) == 0 {
+		columns = conflictColumns
+	}
+	return columns, nil
+}
+
+// upsertOption is insert option of the dialect updating the columns on conflict
+func upsertOption(scope *gorm.Scope, conflict []string, update []string) (string, error) {
+	quote := func(columns []string, format string) string {
+		quoted := make([]string, len(columns))
+		for i, column := range columns {
+			quoted[i] = strings.Replace(format, "%s", scope.Quote(column), -1)
+		}
+		return strings.Join(quoted, ", ")
+	}
+	switch name := scope.Dialect().GetName(); name {
+	case "postgres", "sqlite3":
+		if len(update) == 0 {
+			return fmt.Sprintf("ON CONFLICT (%s) DO NOTHING", quote(conflict, "%s")), nil
+		}
+		option := fmt.Sprintf("ON CONFLICT (%s) DO UPDATE SET %s", quote(conflict, "%s"), quote(update, "%s = excluded.%s"))
+		if field, ok := tenantField(scope); ok {
+			// the row of another tenant is not updated
+			column := scope.Quote(field.DBName)
+			option += fmt.Sprintf(" WHERE %s.%s = excluded.%s", scope.QuotedTableName(), column, column)
+		}
+		return option, nil
+	case "mysql":
+		if len(update) == 0 {
+			update = conflict[:1]
+			return "ON DUPLICATE KEY UPDATE " + quote(update, "%s = %s"), nil
+		}
+		return "ON DUPLICATE KEY UPDATE " + quote(update, "%s = VALUES(%s)"), nil
+	default:
+		return "", fmt.Errorf("upsert is not supported by dialect %s", name)
+	}
+}
+
+// upsert decode one or an array of data and upsert them by conflict columns, see Upserter
+func (g *GenericAPIView) upsert(cxt *Context, decode DecodeFunc, conflict []string, update []string) *Result {
+	upserter, ok := g.view().(Upserter)
+	if !ok {
+		return errorResult(http.StatusNotImplemented, "upsert data", errUpsertUnsupported)
+	}
+	// the row is inserted or updated, both are authorized
+	decision, denied := g.authorize(cxt, ActionCreate)
+	if denied != nil {
+		return denied
+	}
+	updateDecision, denied := g.authorize(cxt, ActionUpdate)
+	if denied != nil {
+		return denied
+	}
+	// forbidden columns are neither inserted nor updated on conflict
+	update, err := forbidUpdate(&gorm.Scope{Value: g.newOne()}, conflict, update, append(decision.Forbid, updateDecision.Forbid...))
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "upsert data", err)
+	}
+	result, err := g.decodeUpsert(cxt, decode)
+	if err != nil {
+		return errorResult(http.StatusBadRequest, "upsert data", err)
+	}
+	for _, item := range upsertItems(result) {
+		for _, d := range []*Decision{decision, updateDecision} {
+			if err := g.guardWrite(cxt, item, ActionCreate, d); err != nil {
+				return errorResult(http.StatusInternalServerError, "upsert data", err)
+			}
+		}
+	}
+	err = upserter.Upsert(result, conflict, update, cxt)
+	if err == gorm.ErrRecordNotFound {
+		return errorResult(http.StatusNotFound, "upsert data", err)
+	}
+	if err != nil {
+		return errorResult(http.StatusInternalServerError, "upsert data", err)
+	}
+	maskFields(result, append(decision.Mask, updateDecision.Mask...))
+	return &Result{Status: http.StatusOK, Entity: result}
+}
+
+// decodeUpsert decode one data by the codec of the request, or an array of data if one can not be decoded,
+// error of decoding one is returned if both fail
+func (g *GenericAPIView) decodeUpsert(cxt *Context, decode DecodeFunc) (interface{}, error) {
+	request := cxt.Request.Request
+	body, err := io.ReadAll(request.Body)
+	if err != nil {
+		return nil, err
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	one := g.newOne()
+	if err = decode(one); err == nil {
+		return one, nil
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	slice := g.newSlice()
+	if decode(slice) != nil {
+		return nil, err
+	}
+	return slice, nil
+}
+
+// splitColumns split comma separated columns of the query parameter
+func splitColumns(s string) []string {
+	var columns []string
+	for _, column := range strings.Split(s, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,129 @@
+package grest_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/emicklei/go-restful"
+	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
+)
+
+type Product struct {
+	ID    uint   `json:"id" gorm:"primary_key"`
+	SKU   string `json:"sku" gorm:"unique_index"`
+	Name  string `json:"name"`
+	Stock int    `json:"stock"`
+}
+
+func TestUpsert(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	var changes []*grest.Change
+	h.API.Context.CommitHooks = []grest.CommitHook{func(change *grest.Change) { changes = append(changes, change) }}
+	h.AddResource(&Product{}, grest.ResourceConfig{Consumes: []string{restful.MIME_JSON, grest.MIMEForm}})
+	h.AddResource(&MemoryUser{}, grest.ResourceConfig{View: grest.NewMemoryView()})
+
+	created := &Product{}
+	h.PUT("/product").Query("onConflict", "sku").JSON(&Product{SKU: "a", Name: "apple", Stock: 1}).
+		Expect().Status(http.StatusOK).JSON(created)
+	if created.ID == 0 || created.Name != "apple" {
+		t.Fatalf("unexpected product %+v", created)
+	}
+
+	// batch, only stock is updated on conflict
+	products := []Product{}
+	h.PUT("/product").Query("onConflict", "sku").Query("update", "stock").
+		JSON([]*Product{{SKU: "a", Name: "avocado", Stock: 5}, {SKU: "b", Name: "banana", Stock: 2}}).
+		Expect().Status(http.StatusOK).JSON(&products)
+	if len(products) != 2 || products[0].ID != created.ID || products[0].Name != "apple" || products[0].Stock != 5 ||
+		products[1].ID == 0 || products[1].Name != "banana" {
+		t.Fatalf("unexpected products %+v", products)
+	}
+	h.GET("/product").Expect().Count(2)
+
+	// all columns are updated by default
+	h.PUT("/product").Query("onConflict", "sku").JSON(&Product{SKU: "b", Name: "blueberry"}).
+		Expect().Status(http.StatusOK).Contains(`"name": "blueberry"`)
+	h.GET("/product").Expect().Count(2)
+
+	if len(changes) != 4 || changes[0].Action != grest.ActionCreate || changes[1].Action != grest.ActionUpdate ||
+		changes[2].Action != grest.ActionCreate || changes[3].Action != grest.ActionUpdate {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	if before := changes[1].Before.(*Product); before.Stock != 1 {
+		t.Fatalf("unexpected before %+v", before)
+	}
+
+	// one statement per batch, the duplicate key starts a new batch
+	defer func(size int) { grest.UpsertBatchSize = size }(grest.UpsertBatchSize)
+	grest.UpsertBatchSize = 2
+	h.PUT("/product").Query("onConflict", "sku").Query("update", "stock").
+		JSON([]*Product{{SKU: "c", Stock: 1}, {SKU: "c", Stock: 2}, {SKU: "d", Stock: 3}, {SKU: "e", Stock: 4}}).
+		Expect().Status(http.StatusOK).JSON(&products)
+	if len(products) != 4 || products[0].ID != products[1].ID || products[1].Stock != 2 || products[3].ID == 0 {
+		t.Fatalf("unexpected products %+v", products)
+	}
+	h.GET("/product").Expect().Count(5)
+
+	// data are decoded by the codec of the request
+	h.PUT("/product").Query("onConflict", "sku").Form(url.Values{"sku": {"a"}, "name": {"apricot"}}).
+		Expect().Status(http.StatusOK).Contains(`"name": "apricot"`)
+	h.PUT("/product").Query("onConflict", "sku").Body(restful.MIME_JSON, []byte(`{"sku": 1}`)).
+		Expect().Status(http.StatusBadRequest)
+
+	h.PUT("/product").Query("onConflict", "color").JSON(&Product{SKU: "c"}).Expect().Status(http.StatusBadRequest)
+	h.PUT("/memory_user").Query("onConflict", "name").JSON(&MemoryUser{}).Expect().Status(http.StatusNotImplemented)
+}
+
+func TestUpsert_Forbid(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	principal := func(cxt *grest.Context) error {
+		cxt.Principal = &grest.Principal{ID: "w", Roles: []string{"writer"}}
+		return nil
+	}
+	policy := grest.RolePolicy{"writer": {{Resource: "Product", Forbid: []string{"name"}}}}
+	h.AddResource(&Product{}, grest.ResourceConfig{Hooks: []grest.ContextHook{principal}, Policy: policy})
+	h.DB.Create(&Product{SKU: "a", Name: "apple", Stock: 1})
+
+	// the forbidden column is not zeroed on conflict
+	h.PUT("/product").Query("onConflict", "sku").JSON(&Product{SKU: "a", Stock: 2}).Expect().Status(http.StatusOK)
+	stored := &Product{}
+	h.DB.First(stored)
+	if stored.Name != "apple" || stored.Stock != 2 {
+		t.Fatalf("unexpected product %+v", stored)
+	}
+	h.PUT("/product").Query("onConflict", "sku").Query("update", "name,stock").JSON(&Product{SKU: "a", Stock: 3}).
+		Expect().Status(http.StatusBadRequest)
+	h.PUT("/product").Query("onConflict", "sku").JSON(&Product{SKU: "a", Name: "avocado"}).Expect().Status(http.StatusForbidden)
+}
+
+type Stock struct {
+	ID       uint   `json:"id" gorm:"primary_key"`
+	TenantID string `json:"tenantId"`
+	SKU      string `json:"sku" gorm:"unique_index"`
+	Count    int    `json:"count"`
+}
+
+func TestUpsert_Tenant(t *testing.T) {
+	h := gresttest.New(t)
+	defer h.Close()
+	tenancy := grest.Tenancy{Resolver: grest.HeaderTenant("X-Tenant-ID"), Required: true}
+	h.AddResource(&Stock{}, grest.ResourceConfig{Hooks: []grest.ContextHook{tenancy.Hook()}})
+
+	upsert := func(tenant string, stock *Stock) *gresttest.Request {
+		return h.PUT("/stock").Query("onConflict", "sku").Header("X-Tenant-ID", tenant).JSON(stock)
+	}
+	upsert("a", &Stock{SKU: "x", Count: 1}).Expect().Status(http.StatusOK)
+	// the row of another tenant is neither read nor updated
+	upsert("b", &Stock{SKU: "x", Count: 2}).Expect().Status(http.StatusNotFound)
+	upsert("a", &Stock{SKU: "x", Count: 3}).Query("update", "tenant_id").Expect().Status(http.StatusBadRequest)
+	stored := &Stock{}
+	h.DB.First(stored)
+	if stored.TenantID != "a" || stored.Count != 1 {
+		t.Fatalf("unexpected stock %+v", stored)
+	}
+	upsert("a", &Stock{SKU: "x", Count: 3}).Expect().Status(http.StatusOK).Contains(`"count": 3`)
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql/driver"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -60,6 +61,15 @@ var GetDBFromRequest = func(req *http.Request) *gorm.DB {
 	return nil
 }
 
+// clientIP is host of the remote address, proxies should be resolved by middleware before
+func clientIP(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
 // HumanizeString Humanize separates string based on capitalizd letters
 // e.g. "OrderItem" -> "Order Item"
 func HumanizeString(str string) string {
@@ -3,6 +3,7 @@ package grest
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 
 	"github.com/jinzhu/gorm"
@@ -79,12 +80,18 @@ func (p *APIView) findCount2(result interface{}, filter map[string]interface{},
 }
 
 // findCount query data count
-func (p *APIView) findCount(result interface{}, where []interface{}, context *Context) (int, error) {
-	db := context.GetDB()
+func (p *APIView) findCount(result interface{}, where []interface{}, context *Context) (count int, err error) {
+	context, span := startSpan(context, "APIView.Count", resourceAttr(result))
+	defer func() { endSpan(span, err, AttrCount.Int(count)) }()
+	if err := checkWhere(where); err != nil {
+		return 0, err
+	}
+	db := traceDB(context.GetReadDB(), context)
 	if db == nil {
 		return 0, errors.New("db is nil")
 	}
 	db = db.Begin()
+	db = applyScopes(db, result, context)
 	db = db.Find(result)
 	if where != nil {
 		if len(where) == 1 {
@@ -93,7 +100,6 @@ func (p *APIView) findCount(result interface{}, where []interface{}, context *Co
 			db = db.Where(where[0], where[1:]...)
 		}
 	}
-	count := 0
 	if db.Error != nil {
 		return 0, db.Error
 	}
@@ -234,13 +240,25 @@ func (p *APIView) FindMany2(result interface{}, filter map[string]interface{}, c
 }
 
 // FindMany query data
-func (p *APIView) FindMany(result interface{}, filter *Filter, context *Context) (int, error) {
-	db := context.GetDB()
+func (p *APIView) FindMany(result interface{}, filter *Filter, context *Context) (count int, err error) {
+	context, span := startSpan(context, "APIView.FindMany", resourceAttr(result))
+	defer func() { endSpan(span, err, AttrRows.Int(rowsOf(result)), AttrCount.Int(count)) }()
+	if filter != nil {
+		if err := checkWhere(filter.Where); err != nil {
+			return 0, err
+		}
+		if err := checkColumns(result, filter, context); err != nil {
+			return 0, err
+		}
+	}
+	db := traceDB(context.GetReadDB(), context)
 	if db == nil {
 		return 0, errors.New("db is nil")
 	}
 	db = db.Begin()
-	var count = 0
+	db = applyScopes(db, result, context)
+	// the filter of slow queries, only the query of result is marked, see SlowLog
+	db = db.Set(slowFilterKey, &slowMark{filter: filter, result: result})
 	if filter != nil {
 		// query fields
 		if filter.Fields != nil && len(filter.Fields) > 0 {
@@ -322,25 +340,70 @@ func (p *APIView) FindMany(result interface{}, filter *Filter, context *Context)
 }
 
 // Save is Model create
-func (p *APIView) Save(result interface{}, context *Context) error {
-	db := context.GetDB()
+func (p *APIView) Save(result interface{}, context *Context) (err error) {
+	context, span := startSpan(context, "APIView.Save", resourceAttr(result))
+	defer func() { endSpan(span, err) }()
+	db := traceDB(context.GetDB(), context)
 	if db == nil {
 		return errors.New("db is nil")
 	}
+	if err := stampTenant(result, context); err != nil {
+		return err
+	}
+	if len(context.WriteHooks) == 0 && len(context.CommitHooks) == 0 {
+		return p.save(db, result, context)
+	}
+	change := newChange(ActionCreate, result, context)
+	err = transaction(db, func(tx *gorm.DB) error {
+		if !tx.NewScope(result).PrimaryKeyZero() {
+			before := reflect.New(ModelType(result)).Interface()
+			for _, field := range tx.NewScope(result).PrimaryFields() {
+				if beforeField, ok := tx.NewScope(before).FieldByName(field.Name); ok {
+					beforeField.Set(field.Field)
+				}
+			}
+			if err := tx.First(before).Error; err == nil {
+				change.Action = ActionUpdate
+				change.Before = before
+			} else if err != gorm.ErrRecordNotFound {
+				return err
+			}
+		}
+		if err := p.save(tx, result, context); err != nil {
+			return err
+		}
+		change.After = copyValue(result)
+		return runWriteHooks(tx, change)
+	})
+	if err != nil {
+		return err
+	}
+	runCommitHooks(change)
+	return nil
+}
+
+// save create or update data in db
+func (p *APIView) save(db *gorm.DB, result interface{}, context *Context) error {
 	if db.NewScope(result).PrimaryKeyZero() {
 		return db.Create(result).Error
 	}
+	if err := checkScope(db, result, context); err != nil {
+		return err
+	}
 	return db.Save(result).Error
 }
 
 // FindOne Model query one data
-func (p *APIView) FindOne(result interface{}, context *Context) error {
+func (p *APIView) FindOne(result interface{}, context *Context) (err error) {
+	context, span := startSpan(context, "APIView.FindOne", resourceAttr(result))
+	defer func() { endSpan(span, err) }()
 	primaryQuerySQL, primaryParams := p.toPrimaryQueryParams(result, context.ResourceID, context)
-	db := context.GetDB()
+	db := traceDB(context.GetReadDB(), context)
 	if db == nil {
 		return errors.New("db is nil")
 	}
 	if primaryQuerySQL != "" {
+		db = applyScopes(db, result, context)
 		return db.First(result, append([]interface{}{primaryQuerySQL}, primaryParams...)...).Error
 	}
 
@@ -348,11 +411,34 @@ func (p *APIView) FindOne(result interface{}, context *Context) error {
 }
 
 // Delete Model delete one data
-func (p *APIView) Delete(result interface{}, context *Context) error {
-	db := context.GetDB()
+func (p *APIView) Delete(result interface{}, context *Context) (err error) {
+	context, span := startSpan(context, "APIView.Delete", resourceAttr(result))
+	defer func() { endSpan(span, err) }()
+	db := traceDB(context.GetDB(), context)
 	if db == nil {
 		return errors.New("db is nil")
 	}
+	if len(context.WriteHooks) == 0 && len(context.CommitHooks) == 0 {
+		return p.delete(db, result, context)
+	}
+	change := newChange(ActionDelete, result, context)
+	err = transaction(db, func(tx *gorm.DB) error {
+		if err := p.delete(tx, result, context); err != nil {
+			return err
+		}
+		change.Before = copyValue(result)
+		return runWriteHooks(tx, change)
+	})
+	if err != nil {
+		return err
+	}
+	runCommitHooks(change)
+	return nil
+}
+
+// delete delete data in db, result is filled with the deleted data
+func (p *APIView) delete(db *gorm.DB, result interface{}, context *Context) error {
+	db = applyScopes(db, result, context)
 	if !db.Find(result).RecordNotFound() {
 		return db.Delete(result).Error
 	}
@@ -2,14 +2,11 @@ package grest_test
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"strconv"
 	"testing"
 
-	"github.com/jinzhu/gorm"
-	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/zhgqiang/grest"
+	"github.com/zhgqiang/grest/gresttest"
 )
 
 type User struct {
@@ -36,17 +33,11 @@ func (Company) TableName() string {
 	return "company"
 }
 
-func TGormDB() *gorm.DB {
-	// root := os.Getenv("GOPATH")
-	db, err := gorm.Open("mysql", fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8&parseTime=True&loc=Local", "root", "dell@123", "101.200.39.236", 3306, "gorm"))
-	if err != nil {
-		log.Panic(err)
-	}
-	return db
-}
-
-func TContext() *grest.Context {
-	return (&grest.Context{}).SetDB(TGormDB())
+func TContext(t *testing.T) *grest.Context {
+	h := gresttest.New(t, &User{}, &Company{})
+	t.Cleanup(h.Close)
+	h.LoadFixtures("testdata/users.yaml", &[]User{})
+	return h.Context()
 }
 
 func TSave(cxt *grest.Context, t *testing.T) *User {
@@ -62,7 +53,7 @@ func TSave(cxt *grest.Context, t *testing.T) *User {
 }
 
 func TestAPIView_Delete(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
 	u := TSave(cxt, t)
@@ -76,7 +67,7 @@ func TestAPIView_Delete(t *testing.T) {
 }
 
 func TestAPIView_FindMany_2(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
 	// filter := map[string]interface{}{
@@ -103,7 +94,7 @@ func TestAPIView_FindMany_2(t *testing.T) {
 }
 
 func TestAPIView_FindMany(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
 	filter := &grest.Filter{WithCount: true, Order: "name", Offset: 2, Limit: 2}
@@ -121,7 +112,7 @@ func TestAPIView_FindMany(t *testing.T) {
 }
 
 func TestAPIView_FindMany_3(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
 	filter := &grest.Filter{Fields: []string{"name"}}
@@ -136,7 +127,7 @@ func TestAPIView_FindMany_3(t *testing.T) {
 }
 
 func TestAPIView_FindMany_4(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
 	filter := &grest.Filter{WithCount: true, Order: "name", Offset: 0, Limit: 2}
@@ -151,10 +142,10 @@ func TestAPIView_FindMany_4(t *testing.T) {
 }
 
 func TestAPIView_FindOne(t *testing.T) {
-	cxt := TContext()
+	cxt := TContext(t)
 	user := new(User)
 
-	u := &User{ID: 16}
+	u := &User{ID: TSave(cxt, t).ID}
 	cxt.ResourceID = strconv.Itoa(int(u.ID))
 	err := user.FindOne(u, cxt)
 	if err != nil {
@@ -163,3 +154,36 @@ func TestAPIView_FindOne(t *testing.T) {
 	b, _ := json.Marshal(u)
 	t.Logf("findone,%+v", string(b))
 }
+
+func TestGenericAPIView_View(t *testing.T) {
+	cxt := TContext(t)
+	g := new(grest.GenericAPIView)
+	g.Init(cxt, &User{})
+
+	// the embedded APIView is used without View
+	users := make([]User, 0)
+	stored, err := g.FindMany(&users, &grest.Filter{}, cxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == 0 || len(users) != stored {
+		t.Fatalf("unexpected users %d %+v", stored, users)
+	}
+
+	memory := grest.NewMemoryView()
+	if err := memory.Load([]User{{Name: "memory"}}); err != nil {
+		t.Fatal(err)
+	}
+	g.View = memory
+	users = make([]User, 0)
+	count, err := g.FindMany(&users, &grest.Filter{}, cxt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 1 || users[0].Name != "memory" {
+		t.Fatalf("unexpected users of View %d %+v", count, users)
+	}
+	if count, err := g.APIView.FindMany(&users, &grest.Filter{}, cxt); err != nil || count != stored {
+		t.Fatalf("unexpected users of APIView %d %v", count, err)
+	}
+}
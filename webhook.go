@@ -0,0 +1,450 @@
+package grest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Status of WebhookDelivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Headers of webhook request
+const (
+	HeaderWebhookID        = "X-Webhook-Id"
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+var errSubscriptionDisabled = errors.New("subscription is disabled")
+
+// WebhookHosts are hosts allowed in urls of subscriptions, ".example.com" allows its subdomains, empty is all hosts
+var WebhookHosts []string
+
+// WebhookPrivate allows urls of loopback, private, link-local and unspecified addresses, default is false
+var WebhookPrivate bool
+
+// WebhookSubscription is endpoint receiving events
+// Resources and Events are comma separated, empty is all
+// Secret is write only, it is masked by AddWebhookResource and the stored one is kept if it is not written on update
+type WebhookSubscription struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	TenantID  string    `json:"tenantId" gorm:"index"`
+	URL       string    `json:"url" grest:"required"`
+	Secret    string    `json:"secret,omitempty"`
+	Resources string    `json:"resources"`
+	Events    string    `json:"events"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// BeforeSave validate the url
+func (s *WebhookSubscription) BeforeSave() error {
+	return ValidateWebhookURL(s.URL)
+}
+
+// BeforeUpdate keep the stored secret if it is not written
+func (s *WebhookSubscription) BeforeUpdate(tx *gorm.DB) error {
+	if s.Secret != "" || s.ID == 0 {
+		return nil
+	}
+	stored := new(WebhookSubscription)
+	if err := tx.New().Select("secret").Where("id = ?", s.ID).First(stored).Error; err != nil && err != gorm.ErrRecordNotFound {
+		return err
+	}
+	s.Secret = stored.Secret
+	return nil
+}
+
+// ValidateWebhookURL check the url is http or https, its host is in WebhookHosts and is not a private address
+// Names are resolved when the request is sent, the client of NewWebhooks refuses to connect to private addresses
+func ValidateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return NewHTTPError(http.StatusBadRequest, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return NewHTTPError(http.StatusBadRequest, fmt.Errorf("webhook url %s is not http or https", raw))
+	}
+	host := strings.ToLower(u.Hostname())
+	if ip := net.ParseIP(host); (ip != nil && privateIP(ip)) || (host == "localhost" && !WebhookPrivate) {
+		return NewHTTPError(http.StatusBadRequest, fmt.Errorf("webhook host %s is a private address", host))
+	}
+	if len(WebhookHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range WebhookHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, ".") && strings.HasSuffix(host, allowed)) {
+			return nil
+		}
+	}
+	return NewHTTPError(http.StatusBadRequest, fmt.Errorf("webhook host %s is not allowed", host))
+}
+
+// privateIP is whether the ip is loopback, private, link-local or unspecified address not allowed by WebhookPrivate
+func privateIP(ip net.IP) bool {
+	if WebhookPrivate {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified()
+}
+
+// webhookClient is http client of webhooks, it checks the resolved address before connecting and does not follow redirects
+func webhookClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return fmt.Errorf("webhook address %s is not allowed", address)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// match is whether the subscription receives the event
+func (s *WebhookSubscription) match(event *OutboxEvent) bool {
+	if s.Disabled || (s.TenantID != "" && s.TenantID != event.TenantID) {
+		return false
+	}
+	return matchList(s.Resources, event.Resource) && matchList(s.Events, event.Type)
+}
+
+// matchList is whether comma separated list contains s, empty list contains all
+func matchList(list, s string) bool {
+	if strings.TrimSpace(list) == "" {
+		return true
+	}
+	for _, item := range strings.Split(list, ",") {
+		if strings.TrimSpace(item) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// OutboxEvent is event persisted in the transaction of the write
+type OutboxEvent struct {
+	ID         uint      `json:"id" gorm:"primary_key"`
+	EventID    string    `json:"eventId" gorm:"unique_index"`
+	Type       string    `json:"type"`
+	Resource   string    `json:"resource"`
+	TenantID   string    `json:"tenantId"`
+	Data       string    `json:"data" gorm:"type:text"`
+	Dispatched bool      `json:"dispatched" gorm:"index"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// WebhookDelivery is delivery of an outbox event to a subscription
+type WebhookDelivery struct {
+	ID             uint      `json:"id" gorm:"primary_key"`
+	OutboxID       uint      `json:"outboxId" gorm:"index"`
+	SubscriptionID uint      `json:"subscriptionId" gorm:"index"`
+	Status         string    `json:"status" gorm:"index"`
+	Attempts       int       `json:"attempts"`
+	NextAttemptAt  time.Time `json:"nextAttemptAt" gorm:"index"`
+	ResponseStatus int       `json:"responseStatus"`
+	LastError      string    `json:"lastError"`
+	CreatedAt      time.Time `json:"createdAt"`
+	UpdatedAt      time.Time `json:"updatedAt"`
+}
+
+// Webhooks deliver events of the outbox to subscriptions
+// the request body is Event, HeaderWebhookSignature is "sha256=" + hex of SignWebhook
+//
+//	webhooks := grest.NewWebhooks(db)
+//	webhooks.Migrate()
+//	api.Context.WriteHooks = append(api.Context.WriteHooks, webhooks.Hook())
+//	api.Context.CommitHooks = append(api.Context.CommitHooks, webhooks.Notify())
+//	api.AddWebhookResource()
+//	go webhooks.Run(ctx)
+type Webhooks struct {
+	DB *gorm.DB
+	// Client sends the deliveries, the default one refuses private addresses and redirects
+	Client *http.Client
+	// MaxAttempts of a delivery, default is 8
+	MaxAttempts int
+	// Backoff is delay before the next attempt, default is DefaultBackoff
+	Backoff func(attempt int) time.Duration
+	// Interval of polling the outbox, default is 5 seconds
+	Interval time.Duration
+	// BatchSize of events and deliveries in one dispatch, default is 100
+	BatchSize int
+	wake      chan struct{}
+}
+
+// NewWebhooks is create Webhooks
+func NewWebhooks(db *gorm.DB) *Webhooks {
+	return &Webhooks{
+		DB:          db,
+		Client:      webhookClient(),
+		MaxAttempts: 8,
+		Backoff:     DefaultBackoff,
+		Interval:    5 * time.Second,
+		BatchSize:   100,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// DefaultBackoff is exponential delay from 1 second to 1 hour
+func DefaultBackoff(attempt int) time.Duration {
+	if attempt > 12 {
+		return time.Hour
+	}
+	delay := time.Second << uint(attempt-1)
+	if delay > time.Hour {
+		return time.Hour
+	}
+	return delay
+}
+
+// SignWebhook is hex HMAC-SHA256 of timestamp + "." + body
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Migrate create tables of subscriptions, outbox and deliveries
+func (w *Webhooks) Migrate() error {
+	return w.DB.AutoMigrate(&WebhookSubscription{}, &OutboxEvent{}, &WebhookDelivery{}).Error
+}
+
+// Hook is WriteHook persisting event of the change into the outbox
+func (w *Webhooks) Hook() WriteHook {
+	return func(tx *gorm.DB, change *Change) error {
+		event, err := change.Event()
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return tx.Create(&OutboxEvent{
+			EventID:  event.ID,
+			Type:     string(event.Type),
+			Resource: event.Resource,
+			TenantID: event.TenantID,
+			Data:     string(data),
+		}).Error
+	}
+}
+
+// Notify is CommitHook waking the dispatcher up
+func (w *Webhooks) Notify() CommitHook {
+	return func(change *Change) {
+		w.Wake()
+	}
+}
+
+// Wake wake the dispatcher up without waiting for the interval
+func (w *Webhooks) Wake() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatch the outbox until ctx is done
+func (w *Webhooks) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		if err := w.Dispatch(ctx); err != nil && ctx.Err() == nil {
+			time.Sleep(w.Interval)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// Dispatch create deliveries of new events, then send due deliveries
+func (w *Webhooks) Dispatch(ctx context.Context) error {
+	if err := w.fanOut(); err != nil {
+		return err
+	}
+	return w.deliver(ctx)
+}
+
+// fanOut create deliveries of undispatched events for matching subscriptions
+func (w *Webhooks) fanOut() error {
+	events := make([]OutboxEvent, 0)
+	if err := w.DB.Where("dispatched = ?", false).Order("id").Limit(w.BatchSize).Find(&events).Error; err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return nil
+	}
+	subscriptions := make([]WebhookSubscription, 0)
+	if err := w.DB.Where("disabled = ?", false).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for i := range events {
+		event := &events[i]
+		err := transaction(w.DB, func(tx *gorm.DB) error {
+			for j := range subscriptions {
+				if !subscriptions[j].match(event) {
+					continue
+				}
+				delivery := &WebhookDelivery{OutboxID: event.ID, SubscriptionID: subscriptions[j].ID, Status: DeliveryPending, NextAttemptAt: now}
+				if err := tx.Create(delivery).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Model(event).Update("dispatched", true).Error
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliver send due deliveries, failed ones are retried with backoff
+func (w *Webhooks) deliver(ctx context.Context) error {
+	deliveries := make([]WebhookDelivery, 0)
+	err := w.DB.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, time.Now()).
+		Order("id").Limit(w.BatchSize).Find(&deliveries).Error
+	if err != nil {
+		return err
+	}
+	for i := range deliveries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		delivery := &deliveries[i]
+		delivery.Attempts++
+		status, err := w.send(ctx, delivery)
+		delivery.ResponseStatus = status
+		switch {
+		case err == nil:
+			delivery.Status = DeliveryDelivered
+			delivery.LastError = ""
+		case err == errSubscriptionDisabled || isHTTPError(err) || delivery.Attempts >= w.MaxAttempts:
+			// the invalid url is not retried
+			delivery.Status = DeliveryFailed
+			delivery.LastError = err.Error()
+		default:
+			delivery.LastError = err.Error()
+			delivery.NextAttemptAt = time.Now().Add(w.Backoff(delivery.Attempts))
+		}
+		if err := w.DB.Save(delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send post the event of the delivery to its subscription
+func (w *Webhooks) send(ctx context.Context, delivery *WebhookDelivery) (int, error) {
+	subscription := new(WebhookSubscription)
+	if err := w.DB.First(subscription, delivery.SubscriptionID).Error; err == gorm.ErrRecordNotFound {
+		return 0, errSubscriptionDisabled
+	} else if err != nil {
+		return 0, err
+	}
+	if subscription.Disabled {
+		return 0, errSubscriptionDisabled
+	}
+	event := new(OutboxEvent)
+	if err := w.DB.First(event, delivery.OutboxID).Error; err != nil {
+		return 0, err
+	}
+
+	// the url is checked again, WebhookHosts may be changed after the subscription is saved
+	if err := ValidateWebhookURL(subscription.URL); err != nil {
+		return 0, err
+	}
+	body := []byte(event.Data)
+	request, err := http.NewRequest(http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderWebhookID, event.EventID)
+	request.Header.Set(HeaderWebhookEvent, event.Resource+"."+event.Type)
+	request.Header.Set(HeaderWebhookTimestamp, timestamp)
+	if subscription.Secret != "" {
+		request.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(subscription.Secret, timestamp, body))
+	}
+	response, err := w.Client.Do(request.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("webhook responded %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// AddWebhookResource register resource of WebhookSubscription, default path is webhooks, the secret is masked in responses
+func (api *API) AddWebhookResource(configs ...ResourceConfig) (*Resource, error) {
+	var config ResourceConfig
+	if len(configs) > 0 {
+		config = configs[0]
+	}
+	if config.Path == "" {
+		config.Path = "webhooks"
+	}
+	policy := config.Policy
+	config.Policy = PolicyFunc(func(cxt *Context, action Action, value interface{}) (*Decision, error) {
+		decision := &Decision{}
+		if policy != nil {
+			evaluated, err := policy.Evaluate(cxt, action, value)
+			if err != nil || (evaluated != nil && evaluated.Deny) {
+				return evaluated, err
+			}
+			if evaluated != nil {
+				copied := *evaluated
+				decision = &copied
+			}
+		}
+		decision.Mask = append(decision.Mask[:len(decision.Mask):len(decision.Mask)], "secret")
+		return decision, nil
+	})
+	return api.AddResource(&WebhookSubscription{}, config)
+}